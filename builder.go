@@ -0,0 +1,144 @@
+package goffkv
+
+import (
+    "errors"
+)
+
+// Result of a transaction committed with CommitCond or TxnBuilder.Commit.
+type TxnResponse struct {
+    // Whether the checks passed and the operations ran; otherwise the else operations did.
+    Succeeded bool
+    // One for every operation of the branch that ran.
+    Results []TxnResult
+}
+
+// Implemented by backends that can run else operations natively.
+type CondCommitter interface {
+    CommitCond(txn Txn, els []Operation, preds []Predicate) (TxnResponse, error)
+}
+
+// Commits txn if its checks and preds pass, or commits els instead if they do not. Both branches
+// may contain reads as described for CommitRead. If an operation fails, the error is a TxnFailure
+// whose OpIndex counts the checks, the predicates and then the operations of the branch that ran,
+// which the response tells.
+//
+// Backends that do not implement CondCommitter commit els separately once the checks have failed,
+// so the keys may have changed in between.
+func CommitCond(c Client, txn Txn, els []Operation, preds ...Predicate) (TxnResponse, error) {
+    if cc, ok := c.(CondCommitter); ok {
+        return cc.CommitCond(txn, els, preds)
+    }
+    base := len(txn.Checks) + len(preds)
+    result, err := CommitRead(c, txn, preds...)
+    var txnErr TxnError
+    if !errors.As(err, &txnErr) || txnErr.OpIndex >= base {
+        return TxnResponse{Succeeded: err == nil, Results: result}, err
+    }
+    result, err = CommitRead(c, Txn{Ops: els})
+    if err != nil {
+        var f TxnFailure
+        if errors.As(err, &f) {
+            f.OpIndex += base
+            err = f
+        } else if errors.As(err, &txnErr) {
+            txnErr.OpIndex += base
+            err = txnErr
+        }
+    }
+    return TxnResponse{Results: result}, err
+}
+
+// Builds a transaction:
+//
+//     resp, err := goffkv.NewTxn().
+//         Require(goffkv.Predicate{Key: "/key", Kind: goffkv.PredValue, Value: old}).
+//         Set("/key", value).
+//         Else(goffkv.Operation{What: goffkv.Get, Key: "/key"}).
+//         Commit(client)
+type TxnBuilder struct {
+    txn Txn
+    preds []Predicate
+    els []Operation
+    hasElse bool
+}
+
+func NewTxn() *TxnBuilder {
+    return &TxnBuilder{}
+}
+
+// Adds a check that the key exists, at version ver unless ver is 0.
+func (b *TxnBuilder) Check(key string, ver Version) *TxnBuilder {
+    return b.If(Check{Key: key, Ver: ver})
+}
+
+func (b *TxnBuilder) If(checks ...Check) *TxnBuilder {
+    b.txn.Checks = append(b.txn.Checks, checks...)
+    return b
+}
+
+// Adds predicates, checked after the checks.
+func (b *TxnBuilder) Require(preds ...Predicate) *TxnBuilder {
+    b.preds = append(b.preds, preds...)
+    return b
+}
+
+func (b *TxnBuilder) Then(ops ...Operation) *TxnBuilder {
+    b.txn.Ops = append(b.txn.Ops, ops...)
+    return b
+}
+
+// Sets the operations to run if the checks fail.
+func (b *TxnBuilder) Else(ops ...Operation) *TxnBuilder {
+    b.els = append(b.els, ops...)
+    b.hasElse = true
+    return b
+}
+
+func (b *TxnBuilder) Create(key string, value []byte) *TxnBuilder {
+    return b.Then(Operation{What: Create, Key: key, Value: value})
+}
+
+func (b *TxnBuilder) CreateLeased(key string, value []byte) *TxnBuilder {
+    return b.Then(Operation{What: Create, Key: key, Value: value, Lease: true})
+}
+
+func (b *TxnBuilder) Set(key string, value []byte) *TxnBuilder {
+    return b.Then(Operation{What: Set, Key: key, Value: value})
+}
+
+func (b *TxnBuilder) Erase(key string) *TxnBuilder {
+    return b.Then(Operation{What: Erase, Key: key})
+}
+
+func (b *TxnBuilder) Get(key string) *TxnBuilder {
+    return b.Then(Operation{What: Get, Key: key})
+}
+
+func (b *TxnBuilder) Exists(key string) *TxnBuilder {
+    return b.Then(Operation{What: Exists, Key: key})
+}
+
+func (b *TxnBuilder) Children(key string) *TxnBuilder {
+    return b.Then(Operation{What: Children, Key: key})
+}
+
+// Returns the transaction built so far, without the predicates and the else operations.
+func (b *TxnBuilder) Txn() Txn {
+    return Txn{
+        Checks: append([]Check{}, b.txn.Checks...),
+        Ops: append([]Operation{}, b.txn.Ops...),
+    }
+}
+
+// Commits the transaction with CommitCond if Else was called, with CommitRead otherwise; in the
+// latter case failed checks are reported as errors.
+func (b *TxnBuilder) Commit(c Client) (TxnResponse, error) {
+    if b.hasElse {
+        return CommitCond(c, b.Txn(), b.els, b.preds...)
+    }
+    result, err := CommitRead(c, b.Txn(), b.preds...)
+    if err != nil {
+        return TxnResponse{}, err
+    }
+    return TxnResponse{Succeeded: true, Results: result}, nil
+}
@@ -0,0 +1,115 @@
+package goffkv_test
+
+import (
+    "bytes"
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "reflect"
+    "testing"
+)
+
+func testTxnBuilder(t *testing.T, client goffkv.Client) {
+    _ = client.Erase("/key", 0)
+    defer client.Erase("/key", 0)
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+
+    ver1, err := client.Create("/key", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    resp, err := goffkv.NewTxn().
+        Check("/key", ver1).
+        Create("/key/child", value2).
+        Set("/key", value2).
+        Get("/key").
+        Commit(client)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !resp.Succeeded || len(resp.Results) != 3 {
+        t.Fatalf("unexpected response %+v", resp)
+    }
+    ver2 := resp.Results[1].Ver
+    if !bytes.Equal(resp.Results[2].Value, value1) {
+        t.Fatalf("expected value %v, found %v", value1, resp.Results[2].Value)
+    }
+
+    // The check fails, so the else branch runs.
+    b := goffkv.NewTxn().
+        Check("/key", ver1).
+        Erase("/key/child").
+        Else(
+            goffkv.Operation{What: goffkv.Get, Key: "/key"},
+            goffkv.Operation{What: goffkv.Set, Key: "/key/child", Value: value1},
+        )
+    resp, err = b.Commit(client)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.Succeeded || len(resp.Results) != 2 {
+        t.Fatalf("unexpected response %+v", resp)
+    }
+    if resp.Results[0].Ver != ver2 || !bytes.Equal(resp.Results[0].Value, value2) {
+        t.Fatalf("unexpected result of get %+v", resp.Results[0])
+    }
+
+    expected := goffkv.Txn{
+        Checks: []goffkv.Check{
+            goffkv.Check{Key: "/key", Ver: ver1},
+        },
+        Ops: []goffkv.Operation{
+            goffkv.Operation{What: goffkv.Erase, Key: "/key/child"},
+        },
+    }
+    if !reflect.DeepEqual(b.Txn(), expected) {
+        t.Fatalf("expected %+v, found %+v", expected, b.Txn())
+    }
+
+    // An operation of the else branch fails.
+    _, err = goffkv.NewTxn().
+        Require(goffkv.Predicate{Key: "/key/child", Kind: goffkv.PredValue, Value: value2}).
+        Erase("/key/child").
+        Else(goffkv.Operation{What: goffkv.Create, Key: "/key/child"}).
+        Commit(client)
+    f, ok := err.(goffkv.TxnFailure)
+    if !ok {
+        t.Fatalf("expected goffkv.TxnFailure error, found %v", err)
+    }
+    if f.OpIndex != 1 || f.Reason != goffkv.OpErrEntryExists {
+        t.Fatalf("unexpected failure %v", f)
+    }
+
+    // Without Else, failed checks are errors.
+    _, err = goffkv.NewTxn().Check("/key", ver1).Erase("/key/child").Commit(client)
+    f, ok = err.(goffkv.TxnFailure)
+    if !ok || f.OpIndex != 0 || f.Reason != goffkv.OpErrVersionMismatch {
+        t.Fatalf("expected version mismatch of check 0, found %v", err)
+    }
+
+    _, value3, _, err := client.Get("/key/child", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(value3, value1) {
+        t.Fatalf("expected value %v, found %v", value1, value3)
+    }
+}
+
+func TestTxnBuilder(t *testing.T) {
+    client, err := goffkv.Open("mem://txn-builder", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        testTxnBuilder(t, client)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        testTxnBuilder(t, plainClient{client})
+    })
+}
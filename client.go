@@ -1,8 +1,11 @@
 package goffkv
 
 import (
+    "context"
+    "errors"
     "strings"
     "fmt"
+    "net"
 )
 
 // This operation could not possibly have successed: for example, a key or address are invalid.
@@ -12,8 +15,16 @@ type UsageError struct {
 }
 
 // This (non-transaction) operation could possibly have successed, but failed.
+//
+// Backends return the bare OpErr* values, so comparing with == keeps working; errors annotated
+// with With or Wrap still match them with errors.Is.
 type OpError struct {
     msg string
+    // The operation and the key it failed on, if known.
+    Op string
+    Key string
+    // The underlying backend error, if any.
+    Err error
 }
 
 // Transaction failed on some operation.
@@ -21,24 +32,123 @@ type TxnError struct {
     OpIndex int
 }
 
+// The backend could not be talked to; the operation may or may not have been applied.
+type ConnError struct {
+    msg string
+    // The underlying backend error, if any.
+    Err error
+}
+
 var (
-    OpErrNoEntry     = OpError{"no entry"}
-    OpErrEntryExists = OpError{"entry exists"}
-    OpErrEphem       = OpError{"attempt to create a child of ephemeral node"}
+    OpErrNoEntry     = OpError{msg: "no entry"}
+    OpErrEntryExists = OpError{msg: "entry exists"}
+    OpErrEphem       = OpError{msg: "attempt to create a child of ephemeral node"}
+    // Only returned by CasStrict and EraseStrict, and as a TxnFailure reason; Cas and Erase report
+    // mismatches as they always did.
+    OpErrVersionMismatch = OpError{msg: "version mismatch"}
+    // Only returned as TxnFailure reasons of PredValue and PredNumChildren predicates.
+    OpErrValueMismatch       = OpError{msg: "value mismatch"}
+    OpErrNumChildrenMismatch = OpError{msg: "number of children mismatch"}
+
+    ErrConnectionLoss = ConnError{msg: "connection loss"}
+    // Leased keys of the session are gone; a new client has to be opened.
+    ErrSessionExpired = ConnError{msg: "session expired"}
+    ErrTimeout        = ConnError{msg: "timeout"}
 )
 
 func (e UsageError) Error() string {
     return fmt.Sprintf("%s: %q", e.msg, e.arg)
 }
 
+// A UsageError matches another one with the same message and either the same or an empty argument.
+func (e UsageError) Is(target error) bool {
+    t, ok := target.(UsageError)
+    return ok && t.msg == e.msg && (t.arg == "" || t.arg == e.arg)
+}
+
 func (e OpError) Error() string {
-    return e.msg
+    s := e.msg
+    switch {
+    case e.Op != "" && e.Key != "":
+        s = fmt.Sprintf("%s %q: %s", e.Op, e.Key, s)
+    case e.Key != "":
+        s = fmt.Sprintf("%q: %s", e.Key, s)
+    case e.Op != "":
+        s = fmt.Sprintf("%s: %s", e.Op, s)
+    }
+    if e.Err != nil {
+        s += ": " + e.Err.Error()
+    }
+    return s
+}
+
+// An OpError matches another one with the same message whose Op and Key are either the same or
+// empty; in particular, every OpError matches the bare OpErr* value it was made from.
+func (e OpError) Is(target error) bool {
+    t, ok := target.(OpError)
+    return ok && t.msg == e.msg && (t.Op == "" || t.Op == e.Op) && (t.Key == "" || t.Key == e.Key)
+}
+
+func (e OpError) Unwrap() error {
+    return e.Err
+}
+
+// Returns a copy of e annotated with the operation and the key it failed on.
+func (e OpError) With(op string, key string) OpError {
+    e.Op, e.Key = op, key
+    return e
+}
+
+// Returns a copy of e wrapping the underlying backend error.
+func (e OpError) Wrap(err error) OpError {
+    e.Err = err
+    return e
 }
 
 func (e TxnError) Error() string {
     return fmt.Sprintf("transaction failed on operation with index %d", e.OpIndex)
 }
 
+func (e ConnError) Error() string {
+    if e.Err != nil {
+        return e.msg + ": " + e.Err.Error()
+    }
+    return e.msg
+}
+
+// A ConnError matches another one with the same message.
+func (e ConnError) Is(target error) bool {
+    t, ok := target.(ConnError)
+    return ok && t.msg == e.msg
+}
+
+func (e ConnError) Unwrap() error {
+    return e.Err
+}
+
+// Returns a copy of e wrapping the underlying backend error.
+func (e ConnError) Wrap(err error) ConnError {
+    e.Err = err
+    return e
+}
+
+// Whether the operation that failed with err may succeed if simply retried with the same
+// arguments: on connection loss or timeout, or on another network failure. A version mismatch is
+// not retryable, as it persists until the version is read again.
+//
+// Only the mem, file and goffkv+http backends report ErrConnectionLoss and ErrTimeout; of the
+// errors the Consul, ZooKeeper and etcd backends return as they get them from their drivers, only
+// those implementing net.Error, such as Consul's HTTP failures, are recognized. ZooKeeper's
+// connection errors and etcd's gRPC ones are not.
+func IsRetryable(err error) bool {
+    if errors.Is(err, ErrConnectionLoss) || errors.Is(err, ErrTimeout) {
+        return true
+    }
+    // The context's deadline implements net.Error too, but has passed for good.
+    var netErr net.Error
+    return errors.As(err, &netErr) && !errors.Is(err, context.DeadlineExceeded)
+}
+
 type Version = uint64
 type Watch = func()
 type Action int
@@ -47,6 +157,10 @@ const (
     Create Action = iota + 1
     Set
     Erase
+    // Read actions; only CommitRead understands them.
+    Get
+    Exists
+    Children
 )
 
 type Check struct {
@@ -59,6 +173,9 @@ type Operation struct {
     Key string
     Value []byte
     Lease bool
+    // If set, the created key is attached to this lease instead of the client's session.
+    // Only backends implementing Leaser honour it.
+    Owner Lease
 }
 
 type Txn struct {
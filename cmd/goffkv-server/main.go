@@ -0,0 +1,63 @@
+// Command goffkv-server serves a goffkv backend over the HTTP/JSON protocol of package httpkv:
+//
+//     goffkv-server -url consul://localhost:8500 -prefix /services
+//
+// Anyone who can reach the server can use it, so it listens on localhost only unless told
+// otherwise with -listen.
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+    _ "github.com/offscale/goffkv-consul"
+    _ "github.com/offscale/goffkv-zk"
+    _ "github.com/offscale/goffkv-etcd"
+    _ "github.com/offscale/goffkv/mem"
+    _ "github.com/offscale/goffkv/file"
+    "github.com/offscale/goffkv/httpkv"
+)
+
+func main() {
+    url := flag.String("url", "mem://default", "backend URL, as taken by goffkv.Open")
+    prefix := flag.String("prefix", "", "prefix all sessions are opened under")
+    listen := flag.String("listen", "localhost:7070", "address to listen on")
+    ttl := flag.Duration("ttl", 10 * time.Second, "default and maximum session TTL")
+    flag.Usage = func() {
+        fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags]\n", os.Args[0])
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+    if flag.NArg() != 0 {
+        flag.Usage()
+        os.Exit(2)
+    }
+
+    server, err := httpkv.NewServer(*url, *prefix, *ttl)
+    if err != nil {
+        log.Fatal(err)
+    }
+    srv := &http.Server{Addr: *listen, Handler: server}
+
+    stop := make(chan os.Signal, 1)
+    signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-stop
+        // Watch streams last as long as their sessions, so those have to end first.
+        server.Close()
+        ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+        defer cancel()
+        _ = srv.Shutdown(ctx)
+    }()
+
+    log.Printf("serving %s on %s", *url, *listen)
+    if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+        log.Fatal(err)
+    }
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io/ioutil"
+    "sort"
+    "strconv"
+    goffkv "github.com/offscale/goffkv"
+)
+
+var commands = map[string]func(e env, args []string) error{
+    "get": cmdGet,
+    "set": cmdSet,
+    "create": cmdCreate,
+    "cas": cmdCas,
+    "rm": cmdRm,
+    "ls": cmdLs,
+    "stat": cmdStat,
+    "watch": cmdWatch,
+    "txn": cmdTxn,
+}
+
+type keyOutput struct {
+    Key string `json:"key"`
+    Ver goffkv.Version `json:"ver,omitempty"`
+    Value []byte `json:"value,omitempty"`
+}
+
+type statOutput struct {
+    Key string `json:"key"`
+    Ver goffkv.Version `json:"ver"`
+    Created goffkv.Version `json:"created,omitempty"`
+    Modified goffkv.Version `json:"modified,omitempty"`
+    NumChildren int `json:"num_children"`
+    DataLength int `json:"data_length"`
+    Leased bool `json:"leased"`
+}
+
+type eventOutput struct {
+    Kind string `json:"kind"`
+    Key string `json:"key"`
+    Ver goffkv.Version `json:"ver,omitempty"`
+}
+
+// Parses the flags of a command, which then takes from min to max arguments.
+func parseArgs(fs *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+    fs.SetOutput(ioutil.Discard)
+    if err := fs.Parse(args); err != nil {
+        return nil, cmdError(fmt.Sprintf("%s: %v", fs.Name(), err))
+    }
+    if fs.NArg() < min || fs.NArg() > max {
+        return nil, cmdError(fmt.Sprintf("%s: wrong number of arguments", fs.Name()))
+    }
+    return fs.Args(), nil
+}
+
+func (e env) value(arg string) ([]byte, error) {
+    if arg == "-" {
+        return ioutil.ReadAll(e.stdin)
+    }
+    return []byte(arg), nil
+}
+
+func (e env) print(v interface{}) error {
+    return json.NewEncoder(e.stdout).Encode(v)
+}
+
+// Keeps the client, and so its leased keys, alive until goffkv is interrupted.
+func (e env) hold() error {
+    <-e.ctx.Done()
+    return nil
+}
+
+func cmdGet(e env, args []string) error {
+    fs := flag.NewFlagSet("get", flag.ContinueOnError)
+    raw := fs.Bool("raw", false, "")
+    args, err := parseArgs(fs, args, 1, 1)
+    if err != nil {
+        return err
+    }
+    ver, value, _, err := e.client.Get(args[0], false)
+    if err != nil {
+        return err
+    }
+    if *raw {
+        _, err := e.stdout.Write(value)
+        return err
+    }
+    return e.print(keyOutput{Key: args[0], Ver: ver, Value: value})
+}
+
+func cmdSet(e env, args []string) error {
+    args, err := parseArgs(flag.NewFlagSet("set", flag.ContinueOnError), args, 2, 2)
+    if err != nil {
+        return err
+    }
+    value, err := e.value(args[1])
+    if err != nil {
+        return err
+    }
+    ver, err := e.client.Set(args[0], value)
+    if err != nil {
+        return err
+    }
+    return e.print(keyOutput{Key: args[0], Ver: ver})
+}
+
+func cmdCreate(e env, args []string) error {
+    fs := flag.NewFlagSet("create", flag.ContinueOnError)
+    lease := fs.Bool("lease", false, "")
+    args, err := parseArgs(fs, args, 1, 2)
+    if err != nil {
+        return err
+    }
+    var value []byte
+    if len(args) == 2 {
+        if value, err = e.value(args[1]); err != nil {
+            return err
+        }
+    }
+    ver, err := e.client.Create(args[0], value, *lease)
+    if err != nil {
+        return err
+    }
+    if err := e.print(keyOutput{Key: args[0], Ver: ver}); err != nil {
+        return err
+    }
+    if *lease {
+        return e.hold()
+    }
+    return nil
+}
+
+func parseVersion(cmd string, s string) (goffkv.Version, error) {
+    ver, err := strconv.ParseUint(s, 10, 64)
+    if err != nil {
+        return 0, cmdError(fmt.Sprintf("%s: invalid version %q", cmd, s))
+    }
+    return ver, nil
+}
+
+func cmdCas(e env, args []string) error {
+    args, err := parseArgs(flag.NewFlagSet("cas", flag.ContinueOnError), args, 3, 3)
+    if err != nil {
+        return err
+    }
+    value, err := e.value(args[1])
+    if err != nil {
+        return err
+    }
+    ver, err := parseVersion("cas", args[2])
+    if err != nil {
+        return err
+    }
+    newVer, err := goffkv.CasStrict(e.client, args[0], value, ver)
+    if err != nil {
+        return err
+    }
+    return e.print(keyOutput{Key: args[0], Ver: newVer})
+}
+
+func cmdRm(e env, args []string) error {
+    fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+    version := fs.String("version", "0", "")
+    args, err := parseArgs(fs, args, 1, 1)
+    if err != nil {
+        return err
+    }
+    ver, err := parseVersion("rm", *version)
+    if err != nil {
+        return err
+    }
+    return goffkv.EraseStrict(e.client, args[0], ver)
+}
+
+func cmdLs(e env, args []string) error {
+    fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+    recursive := fs.Bool("R", false, "")
+    args, err := parseArgs(fs, args, 1, 1)
+    if err != nil {
+        return err
+    }
+    if *recursive {
+        return goffkv.Walk(e.client, args[0], goffkv.WalkOptions{KeysOnly: true}, func(entry goffkv.TreeEntry) error {
+            if entry.Key == args[0] {
+                return nil
+            }
+            return e.print(keyOutput{Key: entry.Key})
+        })
+    }
+
+    children, _, err := e.client.Children(args[0], false)
+    if err != nil {
+        return err
+    }
+    sort.Strings(children)
+    for _, child := range children {
+        if err := e.print(keyOutput{Key: child}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func cmdStat(e env, args []string) error {
+    args, err := parseArgs(flag.NewFlagSet("stat", flag.ContinueOnError), args, 1, 1)
+    if err != nil {
+        return err
+    }
+    stat, _, err := goffkv.StatOf(e.client, args[0], false)
+    if err != nil {
+        return err
+    }
+    return e.print(statOutput{
+        Key: args[0],
+        Ver: stat.Version,
+        Created: stat.Created,
+        Modified: stat.Modified,
+        NumChildren: stat.NumChildren,
+        DataLength: stat.DataLength,
+        Leased: stat.Leased,
+    })
+}
+
+func cmdWatch(e env, args []string) error {
+    fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+    recursive := fs.Bool("R", false, "")
+    count := fs.Int("n", 0, "")
+    args, err := parseArgs(fs, args, 1, 1)
+    if err != nil {
+        return err
+    }
+    key := args[0]
+
+    printEvent := func(ev goffkv.WatchEvent) error {
+        if err := e.print(eventOutput{Kind: ev.Kind.String(), Key: ev.Key, Ver: ev.Ver}); err != nil {
+            return err
+        }
+        if ev.Kind == goffkv.EventSessionLost {
+            return goffkv.ErrSessionExpired
+        }
+        return nil
+    }
+
+    if *recursive {
+        ctx, cancel := context.WithCancel(e.ctx)
+        defer cancel()
+        events, err := goffkv.WatchTree(ctx, e.client, key)
+        if err != nil {
+            return err
+        }
+        for i := 0; *count == 0 || i < *count; i++ {
+            ev, ok := <-events
+            if !ok {
+                return nil
+            }
+            if err := printEvent(ev); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    // Changes made while the watch is being set again are reported as one event.
+    for i := 0; *count == 0 || i < *count; i++ {
+        _, events, err := goffkv.ExistsEvents(e.client, key)
+        if err != nil {
+            return err
+        }
+        select {
+        case ev := <-events:
+            if err := printEvent(ev); err != nil {
+                return err
+            }
+        case <-e.ctx.Done():
+            return nil
+        }
+    }
+    return nil
+}
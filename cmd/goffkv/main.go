@@ -0,0 +1,153 @@
+// Command goffkv reads and writes keys of any goffkv backend:
+//
+//     goffkv -url zk://localhost:2181 -prefix /app get /config
+//
+// Results are written to stdout as JSON lines, values being base64; errors go to stderr, and the
+// exit status tells what kind of error it was (see usage).
+package main
+
+import (
+    "context"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "os/signal"
+    "syscall"
+    _ "github.com/offscale/goffkv-consul"
+    _ "github.com/offscale/goffkv-zk"
+    _ "github.com/offscale/goffkv-etcd"
+    _ "github.com/offscale/goffkv/mem"
+    _ "github.com/offscale/goffkv/file"
+    _ "github.com/offscale/goffkv/httpkv"
+    goffkv "github.com/offscale/goffkv"
+)
+
+const (
+    exitOK = 0
+    exitFailure = 1
+    // Bad command line, or goffkv.UsageError.
+    exitUsage = 2
+    exitOpError = 3
+    exitTxnError = 4
+    exitConnError = 5
+)
+
+const usage = `usage: goffkv [-url URL] [-prefix PREFIX] COMMAND [ARGS]
+
+URL and PREFIX are those taken by goffkv.Open; they default to $GOFFKV_URL and $GOFFKV_PREFIX.
+A VALUE of - is read from stdin.
+
+commands:
+  get [-raw] KEY              print the version and value of KEY; -raw prints the bare value
+  set KEY VALUE               set KEY, creating it if needed
+  create [-lease] KEY [VALUE] create KEY; a leased key lives until goffkv is interrupted
+  cas KEY VALUE VERSION       set KEY if it is at VERSION (0: create it if missing)
+  rm [-version N] KEY         erase KEY and its subtree, if at version N unless N is 0
+  ls [-R] KEY                 list the children of KEY, or its whole subtree with -R
+  stat KEY                    print the metadata of KEY
+  watch [-R] [-n N] KEY       print the events of KEY, or of its subtree with -R, N at most
+  txn [FILE]                  commit the JSON or YAML transaction read from FILE or stdin
+
+A transaction is an object with checks, predicates and operations, such as
+  {"checks": [{"key": "/a", "ver": 3}], "predicates": [{"key": "/b", "kind": "absent"}],
+   "ops": [{"what": "set", "key": "/a", "value": "val"}, {"what": "get", "key": "/c"}]}
+or, in YAML,
+  checks:
+    - {key: /a, ver: 3}
+  predicates:
+    - key: /b
+      kind: absent
+  ops:
+    - {what: set, key: /a, value_base64: dmFs}
+with predicate kinds exists, absent, value and num_children, and actions create, set, erase,
+get, exists and children. Values are given as text with value, or in base64 with value_base64.
+
+exit status:
+  0 success, 1 other failure, 2 usage error, 3 operation error (e.g. no entry, version mismatch),
+  4 transaction check or operation failed, 5 connection error or session expired
+`
+
+// Failures of the command line itself.
+type cmdError string
+
+func (e cmdError) Error() string {
+    return string(e)
+}
+
+type env struct {
+    ctx context.Context
+    client goffkv.Client
+    stdin io.Reader
+    stdout io.Writer
+}
+
+func exitCode(err error) int {
+    var cmdErr cmdError
+    var txnErr goffkv.TxnError
+    var opErr goffkv.OpError
+    var usageErr goffkv.UsageError
+    var connErr goffkv.ConnError
+    switch {
+    case err == nil:
+        return exitOK
+    case errors.As(err, &cmdErr), errors.As(err, &usageErr):
+        return exitUsage
+    // Before OpError, as transaction failures wrap their reasons.
+    case errors.As(err, &txnErr):
+        return exitTxnError
+    case errors.As(err, &opErr):
+        return exitOpError
+    case errors.As(err, &connErr):
+        return exitConnError
+    }
+    return exitFailure
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    fs := flag.NewFlagSet("goffkv", flag.ContinueOnError)
+    fs.SetOutput(stderr)
+    fs.Usage = func() {
+        fmt.Fprint(stderr, usage)
+    }
+    url := fs.String("url", os.Getenv("GOFFKV_URL"), "backend URL")
+    prefix := fs.String("prefix", os.Getenv("GOFFKV_PREFIX"), "key prefix")
+    if err := fs.Parse(args); err != nil {
+        return exitUsage
+    }
+    if fs.NArg() == 0 || *url == "" {
+        fs.Usage()
+        return exitUsage
+    }
+    cmd, ok := commands[fs.Arg(0)]
+    if !ok {
+        fmt.Fprintf(stderr, "goffkv: unknown command %q\n", fs.Arg(0))
+        fs.Usage()
+        return exitUsage
+    }
+
+    client, err := goffkv.Open(*url, *prefix)
+    if err != nil {
+        fmt.Fprintf(stderr, "goffkv: %v\n", err)
+        return exitCode(err)
+    }
+    defer client.Close()
+
+    err = cmd(env{ctx, client, stdin, stdout}, fs.Args()[1:])
+    if err != nil {
+        fmt.Fprintf(stderr, "goffkv: %v\n", err)
+    }
+    return exitCode(err)
+}
+
+func main() {
+    ctx, cancel := context.WithCancel(context.Background())
+    stop := make(chan os.Signal, 1)
+    signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-stop
+        cancel()
+    }()
+    os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "strings"
+    "testing"
+)
+
+func runCli(stdin string, args ...string) (int, string, string) {
+    var stdout, stderr bytes.Buffer
+    args = append([]string{"-url", "mem://cli", "-prefix", "/prefix"}, args...)
+    status := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+    return status, stdout.String(), stderr.String()
+}
+
+// Runs goffkv against an in-memory backend, expecting the given exit status.
+func cli(t *testing.T, stdin string, status int, args ...string) string {
+    got, stdout, stderr := runCli(stdin, args...)
+    if got != status {
+        t.Fatalf("goffkv %v: expected exit status %d, found %d: %s", args, status, got, stderr)
+    }
+    return stdout
+}
+
+func TestCommands(t *testing.T) {
+    // Left by earlier runs.
+    runCli("", "rm", "/dir")
+    cli(t, "", exitOpError, "rm", "/dir")
+
+    if out := cli(t, "", exitOK, "create", "/dir"); !strings.HasPrefix(out, "{\"key\":\"/dir\",\"ver\":") {
+        t.Fatalf("unexpected create output %q", out)
+    }
+    cli(t, "", exitOpError, "create", "/dir")
+    cli(t, "value", exitOK, "set", "/dir/a", "-")
+    cli(t, "", exitOK, "create", "/dir/a/b", "x")
+    cli(t, "", exitUsage, "set", "/dir/a")
+    cli(t, "", exitUsage, "get", "invalid")
+
+    if out := cli(t, "", exitOK, "get", "-raw", "/dir/a"); out != "value" {
+        t.Fatalf("expected value, found %q", out)
+    }
+    if out := cli(t, "", exitOK, "ls", "/dir"); out != "{\"key\":\"/dir/a\"}\n" {
+        t.Fatalf("unexpected ls output %q", out)
+    }
+    if out := cli(t, "", exitOK, "ls", "-R", "/dir"); out != "{\"key\":\"/dir/a\"}\n{\"key\":\"/dir/a/b\"}\n" {
+        t.Fatalf("unexpected ls -R output %q", out)
+    }
+    if out := cli(t, "", exitOK, "stat", "/dir/a"); !strings.Contains(out, "\"num_children\":1,\"data_length\":5") {
+        t.Fatalf("unexpected stat output %q", out)
+    }
+
+    cli(t, "", exitOpError, "cas", "/dir/a", "new", "1000000")
+    cli(t, "", exitOpError, "rm", "-version", "1000000", "/dir/a")
+    cli(t, "", exitUsage, "rm", "-version", "x", "/dir/a")
+
+    txn := `{"predicates": [{"key": "/dir/a", "kind": "value", "value": "value"}],
+             "ops": [{"what": "set", "key": "/dir/a", "value": "new"}, {"what": "children", "key": "/dir"}]}`
+    if out := cli(t, txn, exitOK, "txn"); !strings.Contains(out, "\"children\":[\"/dir/a\"]") {
+        t.Fatalf("unexpected txn output %q", out)
+    }
+    cli(t, txn, exitTxnError, "txn")
+    cli(t, `{"ops": [{"what": "rename"}]}`, exitUsage, "txn")
+    cli(t, `{"ops": [{"what": "set", "key": "/dir/a", "value": "x", "value_base64": "eA=="}]}`, exitUsage, "txn")
+
+    yamlTxn := `# The same, in YAML.
+predicates:
+  - key: /dir/a
+    kind: value
+    value: new
+ops:
+- {what: set, key: "/dir/a", value_base64: dmFsdWU=}  # back to "value"
+- what: get
+  key: /dir/a
+`
+    if out := cli(t, yamlTxn, exitOK, "txn"); !strings.Contains(out, "\"value\":\"bmV3\"") {
+        t.Fatalf("unexpected txn output %q", out)
+    }
+    if out := cli(t, "", exitOK, "get", "-raw", "/dir/a"); out != "value" {
+        t.Fatalf("expected value, found %q", out)
+    }
+    cli(t, yamlTxn, exitTxnError, "txn")
+    cli(t, "checks:\n  - key: /dir/a\n   ver: 1\n", exitUsage, "txn")
+    cli(t, "ops: [{what: erase, key: /dir/a, version: 1}]\n", exitUsage, "txn")
+}
+
+func TestWatch(t *testing.T) {
+    done := make(chan string)
+    go func() {
+        _, stdout, _ := runCli("", "watch", "-n", "1", "/watched")
+        done <- stdout
+    }()
+    for {
+        cli(t, "", exitOK, "set", "/watched", "x")
+        select {
+        case out := <-done:
+            if !strings.HasPrefix(out, "{\"kind\":\"") || !strings.Contains(out, "\"key\":\"/watched\"") {
+                t.Fatalf("unexpected watch output %q", out)
+            }
+            return
+        default:
+        }
+    }
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "io/ioutil"
+    goffkv "github.com/offscale/goffkv"
+    "gopkg.in/yaml.v2"
+)
+
+type checkInput struct {
+    Key string `json:"key" yaml:"key"`
+    Ver goffkv.Version `json:"ver" yaml:"ver"`
+}
+
+// A value is given either as is or, if it is not text, in base64.
+type valueInput struct {
+    Value *string `json:"value" yaml:"value"`
+    ValueBase64 *string `json:"value_base64" yaml:"value_base64"`
+}
+
+type predicateInput struct {
+    Key string `json:"key" yaml:"key"`
+    Kind string `json:"kind" yaml:"kind"`
+    valueInput `yaml:",inline"`
+    NumChildren int `json:"num_children" yaml:"num_children"`
+}
+
+type opInput struct {
+    What string `json:"what" yaml:"what"`
+    Key string `json:"key" yaml:"key"`
+    valueInput `yaml:",inline"`
+    Lease bool `json:"lease" yaml:"lease"`
+}
+
+type txnInput struct {
+    Checks []checkInput `json:"checks" yaml:"checks"`
+    Predicates []predicateInput `json:"predicates" yaml:"predicates"`
+    Ops []opInput `json:"ops" yaml:"ops"`
+}
+
+func (in valueInput) bytes(key string) ([]byte, error) {
+    switch {
+    case in.Value != nil && in.ValueBase64 != nil:
+        return nil, cmdError(fmt.Sprintf("txn: both value and value_base64 given for %q", key))
+    case in.Value != nil:
+        return []byte(*in.Value), nil
+    case in.ValueBase64 != nil:
+        value, err := base64.StdEncoding.DecodeString(*in.ValueBase64)
+        if err != nil {
+            return nil, cmdError(fmt.Sprintf("txn: invalid value_base64 for %q: %v", key, err))
+        }
+        return value, nil
+    }
+    return nil, nil
+}
+
+type resultOutput struct {
+    What string `json:"what"`
+    Key string `json:"key"`
+    Ver goffkv.Version `json:"ver,omitempty"`
+    Value []byte `json:"value,omitempty"`
+    Children []string `json:"children,omitempty"`
+}
+
+type txnOutput struct {
+    Results []resultOutput `json:"results"`
+}
+
+var (
+    predicateKinds = map[string]goffkv.PredicateKind{
+        "exists": goffkv.PredExists,
+        "absent": goffkv.PredAbsent,
+        "value": goffkv.PredValue,
+        "num_children": goffkv.PredNumChildren,
+    }
+    actions = map[string]goffkv.Action{
+        "create": goffkv.Create,
+        "set": goffkv.Set,
+        "erase": goffkv.Erase,
+        "get": goffkv.Get,
+        "exists": goffkv.Exists,
+        "children": goffkv.Children,
+    }
+)
+
+// Returns the transaction read from r, its predicates, and whether it creates leased keys.
+func parseTxn(r io.Reader) (goffkv.Txn, []goffkv.Predicate, bool, error) {
+    data, err := ioutil.ReadAll(r)
+    if err != nil {
+        return goffkv.Txn{}, nil, false, err
+    }
+    var in txnInput
+    // A JSON transaction is an object; anything else is taken for YAML.
+    if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) != 0 && trimmed[0] == '{' {
+        dec := json.NewDecoder(bytes.NewReader(data))
+        dec.DisallowUnknownFields()
+        err = dec.Decode(&in)
+    } else {
+        err = yaml.UnmarshalStrict(data, &in)
+    }
+    if err != nil {
+        return goffkv.Txn{}, nil, false, cmdError("txn: " + err.Error())
+    }
+
+    txn := goffkv.Txn{}
+    for _, check := range in.Checks {
+        txn.Checks = append(txn.Checks, goffkv.Check{Key: check.Key, Ver: check.Ver})
+    }
+    preds := []goffkv.Predicate{}
+    for _, pred := range in.Predicates {
+        kind, ok := predicateKinds[pred.Kind]
+        if !ok {
+            return goffkv.Txn{}, nil, false, cmdError(fmt.Sprintf("txn: unknown predicate kind %q", pred.Kind))
+        }
+        value, err := pred.bytes(pred.Key)
+        if err != nil {
+            return goffkv.Txn{}, nil, false, err
+        }
+        preds = append(preds, goffkv.Predicate{
+            Key: pred.Key,
+            Kind: kind,
+            Value: value,
+            NumChildren: pred.NumChildren,
+        })
+    }
+    leased := false
+    for _, op := range in.Ops {
+        what, ok := actions[op.What]
+        if !ok {
+            return goffkv.Txn{}, nil, false, cmdError(fmt.Sprintf("txn: unknown action %q", op.What))
+        }
+        value, err := op.bytes(op.Key)
+        if err != nil {
+            return goffkv.Txn{}, nil, false, err
+        }
+        txn.Ops = append(txn.Ops, goffkv.Operation{What: what, Key: op.Key, Value: value, Lease: op.Lease})
+        leased = leased || op.Lease
+    }
+    return txn, preds, leased, nil
+}
+
+func cmdTxn(e env, args []string) error {
+    args, err := parseArgs(flag.NewFlagSet("txn", flag.ContinueOnError), args, 0, 1)
+    if err != nil {
+        return err
+    }
+    r := e.stdin
+    if len(args) == 1 && args[0] != "-" {
+        data, err := ioutil.ReadFile(args[0])
+        if err != nil {
+            return err
+        }
+        r = bytes.NewReader(data)
+    }
+    txn, preds, leased, err := parseTxn(r)
+    if err != nil {
+        return err
+    }
+
+    results, err := goffkv.CommitRead(e.client, txn, preds...)
+    if err != nil {
+        return err
+    }
+    out := txnOutput{Results: []resultOutput{}}
+    for i, result := range results {
+        op := txn.Ops[i]
+        name := ""
+        for n, what := range actions {
+            if what == result.What {
+                name = n
+            }
+        }
+        out.Results = append(out.Results, resultOutput{
+            What: name,
+            Key: op.Key,
+            Ver: result.Ver,
+            Value: result.Value,
+            Children: result.Children,
+        })
+    }
+    if err := e.print(out); err != nil {
+        return err
+    }
+    if leased {
+        return e.hold()
+    }
+    return nil
+}
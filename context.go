@@ -0,0 +1,161 @@
+package goffkv
+
+import (
+    "context"
+)
+
+// Same as Client, but every operation takes a context. If the context is done before the
+// operation completes, the context's error is returned: context.DeadlineExceeded if the deadline
+// expired, context.Canceled otherwise. A write that failed so may still have been applied, or be
+// applied later, as not every backend can interrupt it; read the key again to find out. Watches
+// returned by ExistsCtx, GetCtx and ChildrenCtx also return once the context is done. OpErrors
+// are annotated with the operation and the key, so they should be matched with errors.Is rather
+// than ==.
+//
+// The mem and file backends implement it natively: their operations are made only if the context
+// is not done yet, and their watches are released once it is.
+type ClientContext interface {
+    CreateCtx(ctx context.Context, key string, value []byte, lease bool)  (Version, error)
+    SetCtx(ctx context.Context, key string, value []byte)                 (Version, error)
+    CasCtx(ctx context.Context, key string, value []byte, ver Version)    (Version, error)
+    EraseCtx(ctx context.Context, key string, ver Version)                error
+    ExistsCtx(ctx context.Context, key string, watch bool)                (Version, Watch, error)
+    GetCtx(ctx context.Context, key string, watch bool)                   (Version, []byte, Watch, error)
+    ChildrenCtx(ctx context.Context, key string, watch bool)              ([]string, Watch, error)
+    CommitCtx(ctx context.Context, txn Txn)                               ([]TxnOpResult, error)
+    Close()
+}
+
+type ctxClient struct {
+    client Client
+}
+
+// Returns a ClientContext for c. If c implements ClientContext itself, it is returned as is;
+// otherwise the calls are made on c and abandoned (but not interrupted) once the context is done,
+// and watches set on c keep a goroutine waiting for them until they fire.
+func WithContext(c Client) ClientContext {
+    if cc, ok := c.(ClientContext); ok {
+        return cc
+    }
+    return ctxClient{c}
+}
+
+func annotate(err error, op string, key string) error {
+    if e, ok := err.(OpError); ok && e.Key == "" {
+        return e.With(op, key)
+    }
+    return err
+}
+
+func runCtx(ctx context.Context, f func()) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    done := make(chan struct{})
+    go func() {
+        f()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func ctxWatch(ctx context.Context, watch Watch) Watch {
+    if watch == nil {
+        return nil
+    }
+    return func() {
+        done := make(chan struct{})
+        go func() {
+            watch()
+            close(done)
+        }()
+        select {
+        case <-done:
+        case <-ctx.Done():
+        }
+    }
+}
+
+func (c ctxClient) CreateCtx(ctx context.Context, key string, value []byte, lease bool) (Version, error) {
+    var ver Version
+    var err error
+    if ctxErr := runCtx(ctx, func() { ver, err = c.client.Create(key, value, lease) }); ctxErr != nil {
+        return 0, ctxErr
+    }
+    return ver, annotate(err, "create", key)
+}
+
+func (c ctxClient) SetCtx(ctx context.Context, key string, value []byte) (Version, error) {
+    var ver Version
+    var err error
+    if ctxErr := runCtx(ctx, func() { ver, err = c.client.Set(key, value) }); ctxErr != nil {
+        return 0, ctxErr
+    }
+    return ver, annotate(err, "set", key)
+}
+
+func (c ctxClient) CasCtx(ctx context.Context, key string, value []byte, ver Version) (Version, error) {
+    var resultVer Version
+    var err error
+    if ctxErr := runCtx(ctx, func() { resultVer, err = c.client.Cas(key, value, ver) }); ctxErr != nil {
+        return 0, ctxErr
+    }
+    return resultVer, annotate(err, "cas", key)
+}
+
+func (c ctxClient) EraseCtx(ctx context.Context, key string, ver Version) error {
+    var err error
+    if ctxErr := runCtx(ctx, func() { err = c.client.Erase(key, ver) }); ctxErr != nil {
+        return ctxErr
+    }
+    return annotate(err, "erase", key)
+}
+
+func (c ctxClient) ExistsCtx(ctx context.Context, key string, watch bool) (Version, Watch, error) {
+    var ver Version
+    var w Watch
+    var err error
+    if ctxErr := runCtx(ctx, func() { ver, w, err = c.client.Exists(key, watch) }); ctxErr != nil {
+        return 0, nil, ctxErr
+    }
+    return ver, ctxWatch(ctx, w), annotate(err, "exists", key)
+}
+
+func (c ctxClient) GetCtx(ctx context.Context, key string, watch bool) (Version, []byte, Watch, error) {
+    var ver Version
+    var value []byte
+    var w Watch
+    var err error
+    if ctxErr := runCtx(ctx, func() { ver, value, w, err = c.client.Get(key, watch) }); ctxErr != nil {
+        return 0, nil, nil, ctxErr
+    }
+    return ver, value, ctxWatch(ctx, w), annotate(err, "get", key)
+}
+
+func (c ctxClient) ChildrenCtx(ctx context.Context, key string, watch bool) ([]string, Watch, error) {
+    var children []string
+    var w Watch
+    var err error
+    if ctxErr := runCtx(ctx, func() { children, w, err = c.client.Children(key, watch) }); ctxErr != nil {
+        return nil, nil, ctxErr
+    }
+    return children, ctxWatch(ctx, w), annotate(err, "children", key)
+}
+
+func (c ctxClient) CommitCtx(ctx context.Context, txn Txn) ([]TxnOpResult, error) {
+    var result []TxnOpResult
+    var err error
+    if ctxErr := runCtx(ctx, func() { result, err = c.client.Commit(txn) }); ctxErr != nil {
+        return nil, ctxErr
+    }
+    return result, err
+}
+
+func (c ctxClient) Close() {
+    c.client.Close()
+}
@@ -0,0 +1,105 @@
+package goffkv_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+    "context"
+    "errors"
+    "time"
+)
+
+type slowClient struct {
+    goffkv.Client
+    delay time.Duration
+}
+
+func (c slowClient) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    time.Sleep(c.delay)
+    return c.Client.Get(key, watch)
+}
+
+func TestContextDeadline(t *testing.T) {
+    client, err := goffkv.Open("mem://context-deadline", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    cc := goffkv.WithContext(slowClient{client, time.Second})
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+    defer cancel()
+
+    _, _, _, err = cc.GetCtx(ctx, "/key", false)
+    if err != context.DeadlineExceeded {
+        t.Fatalf("expected context.DeadlineExceeded error, found %v", err)
+    }
+}
+
+func TestContextCancelWatch(t *testing.T) {
+    client, err := goffkv.Open("mem://context-cancel", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    _ = client.Erase("/key", 0)
+    cc := goffkv.WithContext(client)
+
+    ctx, cancel := context.WithCancel(context.Background())
+
+    _, err = cc.CreateCtx(ctx, "/key", []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs"), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, _, watch, err := cc.GetCtx(ctx, "/key", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    done := make(chan struct{})
+    go func() {
+        watch()
+        close(done)
+    }()
+    cancel()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatalf("watch did not return after cancellation")
+    }
+
+    _, err = cc.SetCtx(ctx, "/key", []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs"))
+    if err != context.Canceled {
+        t.Fatalf("expected context.Canceled error, found %v", err)
+    }
+}
+
+func TestContextNative(t *testing.T) {
+    client, err := goffkv.Open("mem://context-native", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    _ = client.Erase("/key", 0)
+    if _, ok := client.(goffkv.ClientContext); !ok {
+        t.Fatalf("expected the mem backend to implement goffkv.ClientContext")
+    }
+    cc := goffkv.WithContext(client)
+
+    canceled, cancel := context.WithCancel(context.Background())
+    cancel()
+    _, err = cc.CreateCtx(canceled, "/key", nil, false)
+    if err != context.Canceled {
+        t.Fatalf("expected context.Canceled error, found %v", err)
+    }
+    expectGone(t, client, "/key")
+
+    _, _, err = cc.ChildrenCtx(context.Background(), "/key", false)
+    if !errors.Is(err, goffkv.OpErrNoEntry) || err.Error() != `children "/key": no entry` {
+        t.Fatalf("expected annotated goffkv.OpErrNoEntry error, found %v", err)
+    }
+}
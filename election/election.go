@@ -0,0 +1,227 @@
+// Package election implements leader election on top of goffkv.Client.
+//
+// Every candidate appends a leased, sequentially numbered entry holding its value under the
+// election path; the owner of the first entry is the leader. A crashed leader's entry disappears
+// together with its session, and the next candidate takes over; the leader is told so by Lost if it
+// is still running.
+package election
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+    "github.com/offscale/goffkv/internal/queue"
+)
+
+const (
+    entryPrefix = "candidate-"
+)
+
+var (
+    ErrNoLeader = errors.New("election: no leader")
+    ErrNotCampaigning = errors.New("election: not campaigning")
+    ErrCampaigning = errors.New("election: already campaigning")
+    // The candidate's entry disappeared, e.g. the session expired.
+    ErrLost = errors.New("election: candidacy lost")
+)
+
+type LeaderInfo struct {
+    // The leader's entry under the election path.
+    Key string
+    Value []byte
+}
+
+type Election struct {
+    client goffkv.Client
+    path string
+    queue *queue.Queue
+
+    mu sync.Mutex
+    busy bool
+    key string
+    lost chan struct{}
+    resigned chan struct{}
+}
+
+func New(client goffkv.Client, path string) *Election {
+    return &Election{
+        client: client,
+        path: path,
+        queue: queue.New(client, path, entryPrefix),
+    }
+}
+
+func (e *Election) finish(key string, elected bool) {
+    if !elected && key != "" {
+        _ = e.client.Erase(key, 0)
+    }
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    if !elected {
+        e.busy = false
+        return
+    }
+    e.key = key
+    e.lost = make(chan struct{})
+    e.resigned = make(chan struct{})
+    go e.queue.Monitor(key, e.lost, e.resigned)
+}
+
+// Blocks until this candidate, publishing value, becomes the leader, ctx is done or the
+// candidacy is lost.
+func (e *Election) Campaign(ctx context.Context, value []byte) error {
+    e.mu.Lock()
+    if e.busy {
+        e.mu.Unlock()
+        return ErrCampaigning
+    }
+    e.busy = true
+    e.mu.Unlock()
+
+    key, err := e.queue.Enqueue(ctx, value)
+    if err != nil {
+        e.finish("", false)
+        return err
+    }
+    err = e.queue.Wait(ctx, key)
+    if err == queue.ErrGone {
+        e.finish("", false)
+        return ErrLost
+    }
+    if err != nil {
+        e.finish(key, false)
+        return err
+    }
+    e.finish(key, true)
+    return nil
+}
+
+// Gives up leadership, letting the next candidate take over.
+func (e *Election) Resign() error {
+    e.mu.Lock()
+    key := e.key
+    if key == "" {
+        e.mu.Unlock()
+        return ErrNotCampaigning
+    }
+    e.key = ""
+    e.busy = false
+    close(e.resigned)
+    e.mu.Unlock()
+
+    err := e.client.Erase(key, 0)
+    if errors.Is(err, goffkv.OpErrNoEntry) {
+        return ErrLost
+    }
+    return err
+}
+
+// The key of this candidate's entry if it is the leader, "" otherwise.
+func (e *Election) Key() string {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+
+    return e.key
+}
+
+// Closed once this candidate's entry disappears while it is the leader, e.g. because the client's
+// session expired. The leader should stop acting as such as soon as it is closed. Returns nil if
+// this candidate is not the leader.
+func (e *Election) Lost() <-chan struct{} {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+
+    if e.key == "" {
+        return nil
+    }
+    return e.lost
+}
+
+// Returns the current leader and the value it published.
+func (e *Election) Leader() (LeaderInfo, error) {
+    ctx := context.Background()
+    for {
+        entries, err := e.queue.Entries(ctx)
+        if errors.Is(err, goffkv.OpErrNoEntry) || (err == nil && len(entries) == 0) {
+            return LeaderInfo{}, ErrNoLeader
+        }
+        if err != nil {
+            return LeaderInfo{}, err
+        }
+        _, value, _, err := e.client.Get(entries[0], false)
+        if errors.Is(err, goffkv.OpErrNoEntry) {
+            continue
+        }
+        if err != nil {
+            return LeaderInfo{}, err
+        }
+        return LeaderInfo{Key: entries[0], Value: value}, nil
+    }
+}
+
+// Delivers the current leader, and then every new one, until ctx is done; then the channel is
+// closed. Once there is no leader anymore, a zero LeaderInfo is delivered. The election path need
+// not exist yet, as observing it does not write anything. The channel is also closed if the
+// election path can not be watched anymore, e.g. because the client's session expired.
+func (e *Election) Observe(ctx context.Context) <-chan LeaderInfo {
+    ch := make(chan LeaderInfo)
+    go func() {
+        defer close(ch)
+        if _, err := goffkv.DisassembleKey(e.path); err != nil {
+            return
+        }
+
+        cc := goffkv.WithContext(e.client)
+        var last LeaderInfo
+        for {
+            // Cancelled once the watch is no longer waited for, to release it.
+            wctx, cancel := context.WithCancel(ctx)
+            _, w, err := cc.ChildrenCtx(wctx, e.path, true)
+            if errors.Is(err, goffkv.OpErrNoEntry) {
+                // Nobody has campaigned yet, or the path has been erased.
+                var ver goffkv.Version
+                ver, w, err = cc.ExistsCtx(wctx, e.path, true)
+                if err == nil && ver != 0 {
+                    cancel()
+                    continue
+                }
+            }
+            if err != nil {
+                cancel()
+                return
+            }
+
+            leader, err := e.Leader()
+            if err == ErrNoLeader {
+                leader, err = LeaderInfo{}, nil
+            }
+            if err != nil {
+                cancel()
+                return
+            }
+            if leader.Key != last.Key || !bytes.Equal(leader.Value, last.Value) {
+                select {
+                case ch <- leader:
+                case <-ctx.Done():
+                    cancel()
+                    return
+                }
+                last = leader
+            }
+
+            fired := make(chan struct{})
+            go func() {
+                w()
+                close(fired)
+            }()
+            select {
+            case <-fired:
+            case <-ctx.Done():
+            }
+            cancel()
+        }
+    }()
+    return ch
+}
@@ -0,0 +1,154 @@
+package election_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    "github.com/offscale/goffkv/election"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+    "bytes"
+    "context"
+    "time"
+)
+
+// Hides optional interfaces of the wrapped client, so that the generic fallbacks get tested.
+type plainClient struct {
+    goffkv.Client
+}
+
+func open(t *testing.T, plain bool) goffkv.Client {
+    client, err := goffkv.Open("mem://election", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if plain {
+        return plainClient{client}
+    }
+    return client
+}
+
+func expectLeader(t *testing.T, leaders <-chan election.LeaderInfo, key string, value []byte) {
+    select {
+    case leader := <-leaders:
+        if leader.Key != key || !bytes.Equal(leader.Value, value) {
+            t.Fatalf("expected leader %q (%q), found %q (%q)", key, value, leader.Key, leader.Value)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("timeout reached before leader %q was observed", key)
+    }
+}
+
+func TestElection(t *testing.T) {
+    t.Run("native", func(t *testing.T) {
+        testElection(t, false)
+    })
+    t.Run("fallback", func(t *testing.T) {
+        testElection(t, true)
+    })
+}
+
+func testElection(t *testing.T, plain bool) {
+    client1 := open(t, plain)
+    client2 := open(t, plain)
+    defer client2.Close()
+    observer := open(t, plain)
+    defer observer.Close()
+
+    e1 := election.New(client1, "/election")
+    e2 := election.New(client2, "/election")
+    eo := election.New(observer, "/election")
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    if _, err := eo.Leader(); err != election.ErrNoLeader {
+        t.Fatalf("expected election.ErrNoLeader error, found %v", err)
+    }
+
+    if err := e1.Campaign(ctx, []byte("one")); err != nil {
+        t.Fatal(err)
+    }
+
+    leaders := eo.Observe(ctx)
+    expectLeader(t, leaders, e1.Key(), []byte("one"))
+
+    elected := make(chan error, 1)
+    go func() {
+        elected <- e2.Campaign(ctx, []byte("two"))
+    }()
+
+    select {
+    case err := <-elected:
+        t.Fatalf("Campaign returned %v while another candidate leads", err)
+    case <-time.After(100 * time.Millisecond):
+    }
+
+    // The leader crashes.
+    client1.Close()
+
+    select {
+    case err := <-elected:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("Campaign did not return after the leader was gone")
+    }
+    expectLeader(t, leaders, e2.Key(), []byte("two"))
+
+    leader, err := eo.Leader()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if leader.Key != e2.Key() {
+        t.Fatalf("expected leader %q, found %q", e2.Key(), leader.Key)
+    }
+
+    if err := e2.Resign(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := eo.Leader(); err != election.ErrNoLeader {
+        t.Fatalf("expected election.ErrNoLeader error, found %v", err)
+    }
+    expectLeader(t, leaders, "", nil)
+}
+
+func TestObserveUnused(t *testing.T) {
+    client := open(t, false)
+    defer client.Close()
+    _ = client.Erase("/election-unused", 0)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    leaders := election.New(client, "/election-unused").Observe(ctx)
+
+    time.Sleep(100 * time.Millisecond)
+    if ver, _, err := client.Exists("/election-unused", false); err != nil || ver != 0 {
+        t.Fatalf("election path created by Observe (error %v)", err)
+    }
+
+    e := election.New(client, "/election-unused")
+    if err := e.Campaign(ctx, []byte("one")); err != nil {
+        t.Fatal(err)
+    }
+    expectLeader(t, leaders, e.Key(), []byte("one"))
+}
+
+func TestElectionLost(t *testing.T) {
+    client := open(t, false)
+    e := election.New(client, "/election-lost")
+
+    if e.Lost() != nil {
+        t.Fatalf("expected no Lost channel before being elected")
+    }
+    if err := e.Campaign(context.Background(), []byte("one")); err != nil {
+        t.Fatal(err)
+    }
+
+    client.Close()
+
+    select {
+    case <-e.Lost():
+    case <-time.After(time.Second):
+        t.Fatalf("leadership was not reported lost after Close")
+    }
+}
@@ -0,0 +1,146 @@
+package goffkv_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "net/url"
+)
+
+func TestErrorsIs(t *testing.T) {
+    backendErr := errors.New("backend failure")
+    err := fmt.Errorf("loading config: %w", goffkv.OpErrNoEntry.With("get", "/config").Wrap(backendErr))
+
+    if !errors.Is(err, goffkv.OpErrNoEntry) {
+        t.Fatalf("expected %v to match goffkv.OpErrNoEntry", err)
+    }
+    if errors.Is(err, goffkv.OpErrEntryExists) {
+        t.Fatalf("expected %v not to match goffkv.OpErrEntryExists", err)
+    }
+    if !errors.Is(err, goffkv.OpErrNoEntry.With("get", "/config")) {
+        t.Fatalf("expected %v to match the same operation and key", err)
+    }
+    if errors.Is(err, goffkv.OpErrNoEntry.With("get", "/other")) {
+        t.Fatalf("expected %v not to match another key", err)
+    }
+    if !errors.Is(err, backendErr) {
+        t.Fatalf("expected %v to match the wrapped backend error", err)
+    }
+
+    var opErr goffkv.OpError
+    if !errors.As(err, &opErr) || opErr.Op != "get" || opErr.Key != "/config" {
+        t.Fatalf("expected errors.As to find the annotated goffkv.OpError, found %+v", opErr)
+    }
+    expected := `loading config: get "/config": no entry: backend failure`
+    if err.Error() != expected {
+        t.Fatalf("expected message %q, found %q", expected, err.Error())
+    }
+
+    var txnErr goffkv.TxnError
+    if !errors.As(fmt.Errorf("%w", goffkv.TxnError{OpIndex: 2}), &txnErr) || txnErr.OpIndex != 2 {
+        t.Fatalf("expected errors.As to find goffkv.TxnError, found %+v", txnErr)
+    }
+
+    _, err = goffkv.Open("wrong://localhost", "")
+    var usageErr goffkv.UsageError
+    if !errors.As(fmt.Errorf("%w", err), &usageErr) {
+        t.Fatalf("expected errors.As to find goffkv.UsageError in %v", err)
+    }
+}
+
+func TestContextErrorKey(t *testing.T) {
+    client, err := goffkv.Open("mem://errors", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    _, _, _, err = goffkv.WithContext(client).GetCtx(context.Background(), "/missing", false)
+    var opErr goffkv.OpError
+    if !errors.As(err, &opErr) || opErr.Op != "get" || opErr.Key != "/missing" {
+        t.Fatalf("expected goffkv.OpError annotated with the key, found %v", err)
+    }
+    if !errors.Is(err, goffkv.OpErrNoEntry) {
+        t.Fatalf("expected %v to match goffkv.OpErrNoEntry", err)
+    }
+
+    _, _, _, err = client.Get("/missing", false)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected bare goffkv.OpErrNoEntry error, found %v", err)
+    }
+}
+
+func TestStrict(t *testing.T) {
+    client, err := goffkv.Open("mem://strict", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    _ = client.Erase("/key", 0)
+    defer client.Erase("/key", 0)
+
+    value := []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs")
+
+    ver, err := goffkv.CasStrict(client, "/key", value, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = goffkv.CasStrict(client, "/key", value, 0)
+    if err != goffkv.OpErrEntryExists {
+        t.Fatalf("expected goffkv.OpErrEntryExists error, found %v", err)
+    }
+    _, err = goffkv.CasStrict(client, "/key", value, ver + 1)
+    if err != goffkv.OpErrVersionMismatch {
+        t.Fatalf("expected goffkv.OpErrVersionMismatch error, found %v", err)
+    }
+    if goffkv.IsRetryable(err) {
+        t.Fatalf("expected %v not to be retryable", err)
+    }
+
+    err = goffkv.EraseStrict(client, "/key", ver + 1)
+    if err != goffkv.OpErrVersionMismatch {
+        t.Fatalf("expected goffkv.OpErrVersionMismatch error, found %v", err)
+    }
+    err = goffkv.EraseStrict(client, "/key", ver)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = goffkv.EraseStrict(client, "/key", ver)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+    if goffkv.IsRetryable(err) {
+        t.Fatalf("expected %v not to be retryable", err)
+    }
+}
+
+func TestSessionExpired(t *testing.T) {
+    client, err := goffkv.Open("mem://session-expired", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    client.Close()
+
+    _, _, err = client.Exists("/key", false)
+    if !errors.Is(err, goffkv.ErrSessionExpired) {
+        t.Fatalf("expected goffkv.ErrSessionExpired error, found %v", err)
+    }
+    if goffkv.IsRetryable(err) {
+        t.Fatalf("expected %v not to be retryable", err)
+    }
+    if !goffkv.IsRetryable(fmt.Errorf("%w", goffkv.ErrConnectionLoss.Wrap(errors.New("reset")))) {
+        t.Fatalf("expected connection loss to be retryable")
+    }
+    // As the Consul backend returns them.
+    if !goffkv.IsRetryable(&url.Error{Op: "Get", URL: "http://localhost:8500", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}) {
+        t.Fatalf("expected network failures to be retryable")
+    }
+    if goffkv.IsRetryable(fmt.Errorf("get: %w", context.DeadlineExceeded)) {
+        t.Fatalf("expected a passed deadline not to be retryable")
+    }
+}
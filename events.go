@@ -0,0 +1,119 @@
+package goffkv
+
+type EventKind int
+
+const (
+    EventCreated EventKind = iota + 1
+    EventChanged
+    EventErased
+    EventChildrenChanged
+    // The session the watch belonged to was lost; nothing is known about the key.
+    EventSessionLost
+    // Sent by tree watches when some changes might have been missed; Key is the watched path.
+    EventResync
+)
+
+func (k EventKind) String() string {
+    switch k {
+    case EventCreated:
+        return "created"
+    case EventChanged:
+        return "changed"
+    case EventErased:
+        return "erased"
+    case EventChildrenChanged:
+        return "children changed"
+    case EventSessionLost:
+        return "session lost"
+    case EventResync:
+        return "resync"
+    }
+    return "unknown"
+}
+
+// What happened to a watched key. Ver is the new version of the key, or 0 if it is not known
+// or the key does not exist anymore.
+type WatchEvent struct {
+    Kind EventKind
+    Key string
+    Ver Version
+}
+
+// Implemented by backends that can report watch events natively. Each returned channel delivers
+// exactly one event and is then closed.
+type EventWatcher interface {
+    ExistsEvents(key string)   (Version, <-chan WatchEvent, error)
+    GetEvents(key string)      (Version, []byte, <-chan WatchEvent, error)
+    ChildrenEvents(key string) ([]string, <-chan WatchEvent, error)
+}
+
+func deliverEvent(watch Watch, classify func() WatchEvent) <-chan WatchEvent {
+    ch := make(chan WatchEvent, 1)
+    go func() {
+        watch()
+        ch <- classify()
+        close(ch)
+    }()
+    return ch
+}
+
+// Classifies what happened to a key, known to have had version oldVer, by looking at it again.
+func classifyKeyEvent(c Client, key string, oldVer Version) WatchEvent {
+    ver, _, err := c.Exists(key, false)
+    switch {
+    case err != nil:
+        return WatchEvent{Kind: EventSessionLost, Key: key}
+    case ver == 0:
+        return WatchEvent{Kind: EventErased, Key: key}
+    case oldVer == 0:
+        return WatchEvent{Kind: EventCreated, Key: key, Ver: ver}
+    }
+    return WatchEvent{Kind: EventChanged, Key: key, Ver: ver}
+}
+
+// Same as c.Exists(key, true), but the watch is delivered as an event on a channel.
+func ExistsEvents(c Client, key string) (Version, <-chan WatchEvent, error) {
+    if ew, ok := c.(EventWatcher); ok {
+        return ew.ExistsEvents(key)
+    }
+    ver, watch, err := c.Exists(key, true)
+    if err != nil {
+        return 0, nil, err
+    }
+    return ver, deliverEvent(watch, func() WatchEvent {
+        return classifyKeyEvent(c, key, ver)
+    }), nil
+}
+
+// Same as c.Get(key, true), but the watch is delivered as an event on a channel.
+func GetEvents(c Client, key string) (Version, []byte, <-chan WatchEvent, error) {
+    if ew, ok := c.(EventWatcher); ok {
+        return ew.GetEvents(key)
+    }
+    ver, value, watch, err := c.Get(key, true)
+    if err != nil {
+        return 0, nil, nil, err
+    }
+    return ver, value, deliverEvent(watch, func() WatchEvent {
+        return classifyKeyEvent(c, key, ver)
+    }), nil
+}
+
+// Same as c.Children(key, true), but the watch is delivered as an event on a channel.
+func ChildrenEvents(c Client, key string) ([]string, <-chan WatchEvent, error) {
+    if ew, ok := c.(EventWatcher); ok {
+        return ew.ChildrenEvents(key)
+    }
+    children, watch, err := c.Children(key, true)
+    if err != nil {
+        return nil, nil, err
+    }
+    return children, deliverEvent(watch, func() WatchEvent {
+        ev := classifyKeyEvent(c, key, 1)
+        if ev.Kind == EventChanged {
+            ev.Kind = EventChildrenChanged
+            ev.Ver = 0
+        }
+        return ev
+    }), nil
+}
@@ -0,0 +1,106 @@
+package goffkv_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+    "time"
+)
+
+// Hides optional interfaces of the wrapped client, so that generic fallbacks get tested.
+type plainClient struct {
+    goffkv.Client
+}
+
+func expectEvent(t *testing.T, events <-chan goffkv.WatchEvent, kind goffkv.EventKind, key string) goffkv.WatchEvent {
+    select {
+    case ev := <-events:
+        if ev.Kind != kind || ev.Key != key {
+            t.Fatalf("expected %v event on %q, found %v event on %q", kind, key, ev.Kind, ev.Key)
+        }
+        return ev
+    case <-time.After(time.Second):
+        t.Fatalf("timeout reached before %v event", kind)
+    }
+    panic("unreachable")
+}
+
+func testEvents(t *testing.T, client goffkv.Client) {
+    value := []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs")
+
+    _, events, err := goffkv.ExistsEvents(client, "/key")
+    if err != nil {
+        t.Fatal(err)
+    }
+    ver, err := client.Create("/key", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ev := expectEvent(t, events, goffkv.EventCreated, "/key")
+    if ev.Ver != ver {
+        t.Fatalf("expected version %v, found %v", ver, ev.Ver)
+    }
+
+    _, _, events, err = goffkv.GetEvents(client, "/key")
+    if err != nil {
+        t.Fatal(err)
+    }
+    ver, err = client.Set("/key", value)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ev = expectEvent(t, events, goffkv.EventChanged, "/key")
+    if ev.Ver != ver {
+        t.Fatalf("expected version %v, found %v", ver, ev.Ver)
+    }
+
+    _, events, err = goffkv.ChildrenEvents(client, "/key")
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = client.Create("/key/child", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectEvent(t, events, goffkv.EventChildrenChanged, "/key")
+
+    _, events, err = goffkv.ExistsEvents(client, "/key")
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = client.Erase("/key", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectEvent(t, events, goffkv.EventErased, "/key")
+}
+
+func TestEvents(t *testing.T) {
+    client, err := goffkv.Open("mem://events", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        testEvents(t, client)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        testEvents(t, plainClient{client})
+    })
+}
+
+func TestEventsSessionLost(t *testing.T) {
+    client, err := goffkv.Open("mem://events-session", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, events, err := goffkv.ExistsEvents(client, "/key")
+    if err != nil {
+        t.Fatal(err)
+    }
+    client.Close()
+    expectEvent(t, events, goffkv.EventSessionLost, "/key")
+}
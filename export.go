@@ -0,0 +1,180 @@
+package goffkv
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "strconv"
+)
+
+const (
+    exportFormat = "goffkv-export"
+    exportVersion = 1
+    // Operations Consul accepts per transaction at most.
+    importMaxOps = 64
+    // Backend operations Import may need per key: Consul makes a Create of three, as it makes a
+    // version check of one and a Set of two.
+    importOpsPerKey = 3
+)
+
+type ImportMode int
+
+const (
+    // Import fails with OpErrEntryExists if one of the keys exists.
+    ImportFailIfExists ImportMode = iota
+    // Existing keys are set to the imported values; whether they are leased does not change.
+    ImportOverwrite
+    // Existing keys are left as they are.
+    ImportMerge
+)
+
+// First line of an export.
+type exportHeader struct {
+    Format string `json:"format"`
+    Version int `json:"version"`
+    Root string `json:"root"`
+}
+
+// Every other line of an export: a key, by its path relative to the root ("" for the root
+// itself), with its value in base64.
+type exportRecord struct {
+    Path string `json:"path"`
+    Value []byte `json:"value,omitempty"`
+    Leased bool `json:"leased,omitempty"`
+}
+
+// Writes root and every key under it to w as JSON lines: a header, then the keys, parents before
+// their children. Keys are read as Walk reads them, so the export is not a consistent snapshot
+// while they are being changed. Leased keys are flagged as such only on backends implementing
+// StatReader.
+func Export(c Client, root string, w io.Writer) error {
+    enc := json.NewEncoder(w)
+    if err := enc.Encode(exportHeader{Format: exportFormat, Version: exportVersion, Root: root}); err != nil {
+        return err
+    }
+    _, statReader := c.(StatReader)
+    return Walk(c, root, WalkOptions{}, func(entry TreeEntry) error {
+        rec := exportRecord{Path: entry.Key[len(root):], Value: entry.Value}
+        if statReader {
+            stat, _, err := StatOf(c, entry.Key, false)
+            if errors.Is(err, OpErrNoEntry) {
+                // Erased while exporting.
+                return nil
+            }
+            if err != nil {
+                return err
+            }
+            rec.Leased = stat.Leased
+        }
+        return enc.Encode(rec)
+    })
+}
+
+// Recreates the keys exported by Export under root, which may differ from the exported one; the
+// parent of root must exist. Leased keys are attached to c's session.
+//
+// Keys are written in transactions of up to 64 backend operations, each checking that the keys have
+// not changed since they were looked up, and retried after a backoff if they have. If importing
+// fails, the transactions committed before stay.
+func Import(c Client, root string, r io.Reader, mode ImportMode) error {
+    if _, err := DisassembleKey(root); err != nil {
+        return err
+    }
+    if mode < ImportFailIfExists || mode > ImportMerge {
+        return UsageError{msg: "invalid import mode", arg: strconv.Itoa(int(mode))}
+    }
+
+    dec := json.NewDecoder(r)
+    var header exportHeader
+    if err := dec.Decode(&header); err != nil {
+        return err
+    }
+    if header.Format != exportFormat {
+        return UsageError{msg: "not a goffkv export", arg: header.Format}
+    }
+    if header.Version != exportVersion {
+        return UsageError{msg: "unsupported export version", arg: strconv.Itoa(header.Version)}
+    }
+
+    batch := []exportRecord{}
+    for {
+        var rec exportRecord
+        err := dec.Decode(&rec)
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return err
+        }
+        if rec.Path != "" {
+            if _, err := DisassembleKey(rec.Path); err != nil {
+                return err
+            }
+        }
+        if batch = append(batch, rec); (len(batch) + 1) * importOpsPerKey > importMaxOps {
+            if err := importBatch(c, root, batch, mode); err != nil {
+                return err
+            }
+            batch = batch[:0]
+        }
+    }
+    return importBatch(c, root, batch, mode)
+}
+
+func importBatch(c Client, root string, batch []exportRecord, mode ImportMode) error {
+    if len(batch) == 0 {
+        return nil
+    }
+    keys := []string{}
+    for _, rec := range batch {
+        keys = append(keys, root + rec.Path)
+    }
+
+    d := updateBackoffMin
+    for {
+        current, err := GetMany(c, keys)
+        if err != nil {
+            return err
+        }
+
+        txn := Txn{}
+        for i, rec := range batch {
+            key := keys[i]
+            cur := current[i]
+            exists := cur.Err == nil
+            if cur.Err != nil && !errors.Is(cur.Err, OpErrNoEntry) {
+                return cur.Err
+            }
+
+            switch {
+            case !exists:
+                // Create fails by itself if the key has been created since.
+                txn.Ops = append(txn.Ops, Operation{What: Create, Key: key, Value: rec.Value, Lease: rec.Leased})
+            case mode == ImportFailIfExists:
+                return OpErrEntryExists.With("import", key)
+            case mode == ImportOverwrite:
+                txn.Checks = append(txn.Checks, Check{Key: key, Ver: cur.Ver})
+                txn.Ops = append(txn.Ops, Operation{What: Set, Key: key, Value: rec.Value})
+            }
+        }
+        if len(txn.Ops) == 0 {
+            return nil
+        }
+
+        _, err = CommitDetailed(c, txn)
+        var f TxnFailure
+        if errors.As(err, &f) && f.Reason == OpErrEntryExists && mode == ImportFailIfExists {
+            return OpErrEntryExists.With("import", f.Key)
+        }
+        changed := errors.As(err, &f) &&
+            (f.OpIndex < len(txn.Checks) || f.Reason == OpErrEntryExists)
+        if changed {
+            if err := backoff(context.Background(), &d); err != nil {
+                return err
+            }
+            continue
+        }
+        return err
+    }
+}
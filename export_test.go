@@ -0,0 +1,153 @@
+package goffkv_test
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "strings"
+    "testing"
+)
+
+func expectTree(t *testing.T, client goffkv.Client, root string, expected map[string][]byte) {
+    entries, err := goffkv.GetTree(client, root, goffkv.WalkOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(entries) != len(expected) {
+        t.Fatalf("expected %d keys, found %d", len(expected), len(entries))
+    }
+    for _, entry := range entries {
+        value, ok := expected[strings.TrimPrefix(entry.Key, root)]
+        if !ok || !bytes.Equal(entry.Value, value) {
+            t.Fatalf("unexpected key %s with value %q", entry.Key, entry.Value)
+        }
+    }
+}
+
+func testExport(t *testing.T, client goffkv.Client, leases bool) {
+    _ = client.Erase("/src", 0)
+    defer client.Erase("/src", 0)
+    _ = client.Erase("/dst", 0)
+    defer client.Erase("/dst", 0)
+
+    expected := map[string][]byte{
+        "": []byte("root"),
+        "/bin": {0, 255, 1},
+        "/many": nil,
+        "/leased": []byte("leased"),
+    }
+    // More keys than are imported per transaction.
+    for i := 0; i < 40; i++ {
+        expected[fmt.Sprintf("/many/k%02d", i)] = []byte(fmt.Sprint(i))
+    }
+    for _, path := range []string{"", "/bin", "/many", "/leased"} {
+        if _, err := client.Create("/src" + path, expected[path], path == "/leased"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for i := 0; i < 40; i++ {
+        path := fmt.Sprintf("/many/k%02d", i)
+        if _, err := client.Create("/src" + path, expected[path], false); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    var buf bytes.Buffer
+    if err := goffkv.Export(client, "/src", &buf); err != nil {
+        t.Fatal(err)
+    }
+    export := buf.String()
+
+    if err := goffkv.Import(client, "/dst", strings.NewReader(export), goffkv.ImportFailIfExists); err != nil {
+        t.Fatal(err)
+    }
+    expectTree(t, client, "/dst", expected)
+    if leases {
+        stat, _, err := goffkv.StatOf(client, "/dst/leased", false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !stat.Leased {
+            t.Fatalf("expected /dst/leased to be leased")
+        }
+    }
+
+    err := goffkv.Import(client, "/dst", strings.NewReader(export), goffkv.ImportFailIfExists)
+    if !errors.Is(err, goffkv.OpErrEntryExists) {
+        t.Fatalf("expected goffkv.OpErrEntryExists error, found %v", err)
+    }
+
+    if _, err := client.Set("/dst/bin", []byte("changed")); err != nil {
+        t.Fatal(err)
+    }
+    if err := client.Erase("/dst/many/k00", 0); err != nil {
+        t.Fatal(err)
+    }
+    if err := goffkv.Import(client, "/dst", strings.NewReader(export), goffkv.ImportMerge); err != nil {
+        t.Fatal(err)
+    }
+    merged := make(map[string][]byte)
+    for path, value := range expected {
+        merged[path] = value
+    }
+    merged["/bin"] = []byte("changed")
+    expectTree(t, client, "/dst", merged)
+
+    if err := goffkv.Import(client, "/dst", strings.NewReader(export), goffkv.ImportOverwrite); err != nil {
+        t.Fatal(err)
+    }
+    expectTree(t, client, "/dst", expected)
+}
+
+// Fails transactions Consul would reject: of more than 64 operations, as it counts them, or
+// writing a key twice.
+type consulLimitClient struct {
+    plainClient
+}
+
+func (c consulLimitClient) Commit(txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    ops := len(txn.Checks)
+    written := make(map[string]bool)
+    for _, op := range txn.Ops {
+        if written[op.Key] {
+            return nil, fmt.Errorf("%s written twice", op.Key)
+        }
+        written[op.Key] = true
+        if op.What == goffkv.Set {
+            ops += 2
+        } else {
+            ops += 3
+        }
+    }
+    if ops > 64 {
+        return nil, fmt.Errorf("transaction of %d operations", ops)
+    }
+    return c.plainClient.Commit(txn)
+}
+
+func TestExport(t *testing.T) {
+    client, err := goffkv.Open("mem://export", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        testExport(t, client, true)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        testExport(t, plainClient{client}, false)
+    })
+
+    t.Run("consul_limits", func(t *testing.T) {
+        testExport(t, consulLimitClient{plainClient{client}}, false)
+    })
+
+    err = goffkv.Import(client, "/dst", strings.NewReader(`{"format":"goffkv-export","version":2,"root":"/src"}`), goffkv.ImportMerge)
+    if _, ok := err.(goffkv.UsageError); !ok {
+        t.Fatalf("expected goffkv.UsageError error, found %v", err)
+    }
+}
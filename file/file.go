@@ -0,0 +1,273 @@
+// Package goffkv_file implements a durable single-node backend, registered as "file", that keeps
+// its data in a directory (file://path/to/db): a snapshot, and a journal of the changes made since,
+// which is synced on every change. A change torn by a crash is discarded on the next open, as are
+// leased keys.
+//
+// All the clients of one directory in a process share its data, watches and leases. A process
+// holds a lock on the directory while it has clients of it open, and other processes fail to open
+// it meanwhile. The lock is released by the system when the process dies, except on systems without
+// flock, where a lock file left by a crash has to be removed by hand.
+package goffkv_file
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+    "github.com/offscale/goffkv/internal/engine"
+)
+
+const (
+    snapshotName = "snapshot.json"
+    journalName = "journal.jsonl"
+    lockName = "lock"
+    // Records the journal may grow to before it is compacted into a new snapshot.
+    maxJournalRecords = 10000
+)
+
+var (
+    errEmptyPath = errors.New("file: empty path")
+    errClosed = errors.New("file: database is closed")
+    errLocked = errors.New("file: database is in use by another process")
+)
+
+type db struct {
+    dir string
+    // Held until the last client is closed.
+    lock *os.File
+    store *engine.Store
+    // Clients that have not been closed yet.
+    clients int
+
+    mu sync.Mutex
+    journal *os.File
+    size int64
+    records int
+    // Set once the journal could not be written nor restored.
+    broken error
+}
+
+var (
+    dbsMu sync.Mutex
+    dbs = make(map[string]*db)
+)
+
+func New(address string, prefix string) (goffkv.Client, error) {
+    if address == "" {
+        return nil, errEmptyPath
+    }
+    if _, err := goffkv.DisassemblePath(prefix); err != nil {
+        return nil, err
+    }
+    dir, err := filepath.Abs(address)
+    if err != nil {
+        return nil, err
+    }
+
+    dbsMu.Lock()
+    defer dbsMu.Unlock()
+
+    d, ok := dbs[dir]
+    if !ok {
+        if d, err = open(dir); err != nil {
+            return nil, err
+        }
+        dbs[dir] = d
+    }
+    c, err := engine.NewClient(d.store, prefix, d.release)
+    if err != nil {
+        return nil, err
+    }
+    d.clients++
+    return c, nil
+}
+
+// Closes the journal once the last client is closed; the next client opened reloads the data.
+func (d *db) release() {
+    dbsMu.Lock()
+    defer dbsMu.Unlock()
+
+    if d.clients--; d.clients != 0 {
+        return
+    }
+    delete(dbs, d.dir)
+
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    _ = d.journal.Close()
+    d.broken = errClosed
+    unlockDir(d.dir, d.lock)
+}
+
+func open(dir string) (*db, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+    lock, err := lockDir(dir)
+    if err != nil {
+        return nil, err
+    }
+    d, err := load(dir)
+    if err != nil {
+        unlockDir(dir, lock)
+        return nil, err
+    }
+    d.lock = lock
+    return d, nil
+}
+
+func load(dir string) (*db, error) {
+    d := &db{
+        dir: dir,
+        store: engine.NewStore(),
+    }
+
+    var snapshot engine.Record
+    data, err := ioutil.ReadFile(filepath.Join(dir, snapshotName))
+    switch {
+    case err == nil:
+        if err := json.Unmarshal(data, &snapshot); err != nil {
+            return nil, err
+        }
+        d.store.Load(snapshot)
+    case !os.IsNotExist(err):
+        return nil, err
+    }
+
+    f, err := os.Open(filepath.Join(dir, journalName))
+    switch {
+    case err == nil:
+        err = replay(f, snapshot.Rev, d.store)
+        f.Close()
+        if err != nil {
+            return nil, err
+        }
+    case !os.IsNotExist(err):
+        return nil, err
+    }
+    d.store.DropLeased()
+
+    if err := d.compact(d.store.Snapshot()); err != nil {
+        return nil, err
+    }
+    d.store.SetJournal(d)
+    return d, nil
+}
+
+// Applies the records of the journal newer than the snapshot, up to the first torn one.
+func replay(f *os.File, snapshotRev goffkv.Version, s *engine.Store) error {
+    r := bufio.NewReader(f)
+    for {
+        line, err := r.ReadBytes('\n')
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        var rec engine.Record
+        if err := json.Unmarshal(line, &rec); err != nil {
+            return nil
+        }
+        if rec.Rev > snapshotRev {
+            s.Load(rec)
+        }
+    }
+}
+
+func syncDir(dir string) error {
+    f, err := os.Open(dir)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    return f.Sync()
+}
+
+// Replaces the snapshot with rec and starts a new, empty journal.
+func (d *db) compact(rec engine.Record) error {
+    data, err := json.Marshal(rec)
+    if err != nil {
+        return err
+    }
+    tmp := filepath.Join(d.dir, snapshotName + ".tmp")
+    f, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+    _, err = f.Write(data)
+    if err == nil {
+        err = f.Sync()
+    }
+    if closeErr := f.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        err = os.Rename(tmp, filepath.Join(d.dir, snapshotName))
+    }
+    if err != nil {
+        _ = os.Remove(tmp)
+        return err
+    }
+
+    // Records the old journal still holds are older than the snapshot, so they are skipped if the
+    // truncation does not make it to the disk.
+    journal, err := os.OpenFile(filepath.Join(d.dir, journalName), os.O_CREATE | os.O_TRUNC | os.O_WRONLY, 0644)
+    if err != nil {
+        return err
+    }
+    if err := syncDir(d.dir); err != nil {
+        journal.Close()
+        return err
+    }
+    if d.journal != nil {
+        _ = d.journal.Close()
+    }
+    d.journal, d.size, d.records = journal, 0, 0
+    return nil
+}
+
+func (d *db) Append(rec engine.Record) error {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    if d.broken != nil {
+        return d.broken
+    }
+    data, err := json.Marshal(rec)
+    if err != nil {
+        return err
+    }
+    data = append(data, '\n')
+
+    _, err = d.journal.Write(data)
+    if err == nil {
+        err = d.journal.Sync()
+    }
+    if err != nil {
+        // Cut the torn record off, or nothing written after it would be replayed.
+        if truncErr := d.journal.Truncate(d.size); truncErr != nil {
+            d.broken = truncErr
+        } else if _, seekErr := d.journal.Seek(d.size, io.SeekStart); seekErr != nil {
+            d.broken = seekErr
+        }
+        return err
+    }
+    d.size += int64(len(data))
+    d.records++
+
+    if d.records >= maxJournalRecords {
+        // The record is durable already; compaction is retried with the next one if it fails.
+        _ = d.compact(d.store.Snapshot())
+    }
+    return nil
+}
+
+func init() {
+    goffkv.RegisterClient("file", New)
+}
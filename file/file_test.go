@@ -0,0 +1,202 @@
+package goffkv_file_test
+
+import (
+    "bytes"
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/file"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "testing"
+    "time"
+)
+
+// Copies the files of a database as a crash would leave them, with a torn record at the end.
+func crashCopy(t *testing.T, src string, dst string) {
+    for _, name := range []string{"snapshot.json", "journal.jsonl"} {
+        data, err := ioutil.ReadFile(filepath.Join(src, name))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if name == "journal.jsonl" {
+            data = append(data, []byte(`{"rev":1000,"muts":[{"path":"/torn"`)...)
+        }
+        if err := ioutil.WriteFile(filepath.Join(dst, name), data, 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+func TestFileDurability(t *testing.T) {
+    dir, err := ioutil.TempDir("", "goffkv")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    crashed, err := ioutil.TempDir("", "goffkv")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(crashed)
+
+    client, err := goffkv.Open("file://" + dir, "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    other, err := goffkv.Open("file://" + dir, "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    value := []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs")
+    if _, err := client.Create("/key", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := client.Create("/key/child", value, false); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := client.Create("/leased", value, true); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := goffkv.CreateSequential(client, "/key/item-", nil, false); err != nil {
+        t.Fatal(err)
+    }
+
+    // Clients of the same database see each other's changes.
+    _, _, events, err := goffkv.GetEvents(other, "/key")
+    if err != nil {
+        t.Fatal(err)
+    }
+    ver, err := client.Set("/key", value)
+    if err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case ev := <-events:
+        if ev.Kind != goffkv.EventChanged || ev.Key != "/key" {
+            t.Fatalf("expected changed event on /key, found %v event on %q", ev.Kind, ev.Key)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("timeout reached before changed event")
+    }
+
+    crashCopy(t, dir, crashed)
+    other.Close()
+    client.Close()
+
+    for _, d := range []string{dir, crashed} {
+        client, err := goffkv.Open("file://" + d, "/prefix")
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        ver2, value2, _, err := client.Get("/key", false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if ver2 != ver || !bytes.Equal(value2, value) {
+            t.Fatalf("expected value %v at version %v, found %v at %v", value, ver, value2, ver2)
+        }
+        children, _, err := client.Children("/key", false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        sort.Strings(children)
+        if !reflect.DeepEqual(children, []string{"/key/child", "/key/item-0000000000"}) {
+            t.Fatalf("unexpected children %v", children)
+        }
+        for _, key := range []string{"/leased", "/torn"} {
+            ver3, _, err := client.Exists(key, false)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if ver3 != 0 {
+                t.Fatalf("expected %s to be gone, found version %v", key, ver3)
+            }
+        }
+
+        key, ver4, err := goffkv.CreateSequential(client, "/key/item-", nil, false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if key != "/key/item-0000000001" {
+            t.Fatalf("expected /key/item-0000000001, found %s", key)
+        }
+        if ver4 <= ver {
+            t.Fatalf("expected version greater than %v, found %v", ver, ver4)
+        }
+        client.Close()
+    }
+}
+
+// Run by TestFileLocked in another process: tries to open the database and reports how it went.
+func TestFileLockedHelper(t *testing.T) {
+    dir := os.Getenv("GOFFKV_FILE_LOCKED_DIR")
+    if dir == "" {
+        t.Skip("only run by TestFileLocked")
+    }
+    client, err := goffkv.Open("file://" + dir, "")
+    if err != nil {
+        os.Stdout.WriteString("locked\n")
+        return
+    }
+    client.Close()
+    os.Stdout.WriteString("opened\n")
+}
+
+func TestFileLocked(t *testing.T) {
+    dir, err := ioutil.TempDir("", "goffkv")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    // Opens the database in another process.
+    openElsewhere := func() string {
+        cmd := exec.Command(os.Args[0], "-test.run=^TestFileLockedHelper$", "-test.v")
+        cmd.Env = append(os.Environ(), "GOFFKV_FILE_LOCKED_DIR=" + dir)
+        out, err := cmd.Output()
+        if err != nil {
+            t.Fatalf("%v: %s", err, out)
+        }
+        switch {
+        case bytes.Contains(out, []byte("locked\n")):
+            return "locked"
+        case bytes.Contains(out, []byte("opened\n")):
+            return "opened"
+        }
+        t.Fatalf("unexpected output %q", out)
+        return ""
+    }
+
+    client, err := goffkv.Open("file://" + dir, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := client.Create("/key", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if result := openElsewhere(); result != "locked" {
+        t.Fatalf("expected the database to be locked, found it %s", result)
+    }
+    // The journal has been left alone.
+    if _, err := client.Set("/key", []byte("value")); err != nil {
+        t.Fatal(err)
+    }
+
+    client.Close()
+    if result := openElsewhere(); result != "opened" {
+        t.Fatalf("expected the database to be opened once closed, found it %s", result)
+    }
+    client, err = goffkv.Open("file://" + dir, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+    if _, value, _, err := client.Get("/key", false); err != nil || string(value) != "value" {
+        t.Fatalf("expected value %q, found %q (error %v)", "value", value, err)
+    }
+}
@@ -0,0 +1,29 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package goffkv_file
+
+import (
+    "os"
+    "path/filepath"
+    "syscall"
+)
+
+// Locks dir against other processes; the lock goes with the process.
+func lockDir(dir string) (*os.File, error) {
+    f, err := os.OpenFile(filepath.Join(dir, lockName), os.O_CREATE | os.O_RDWR, 0644)
+    if err != nil {
+        return nil, err
+    }
+    if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX | syscall.LOCK_NB); err != nil {
+        f.Close()
+        if err == syscall.EWOULDBLOCK {
+            return nil, errLocked
+        }
+        return nil, err
+    }
+    return f, nil
+}
+
+func unlockDir(dir string, lock *os.File) {
+    _ = lock.Close()
+}
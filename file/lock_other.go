@@ -0,0 +1,22 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package goffkv_file
+
+import (
+    "os"
+    "path/filepath"
+)
+
+// Locks dir against other processes by creating the lock file, which outlives a crash.
+func lockDir(dir string) (*os.File, error) {
+    f, err := os.OpenFile(filepath.Join(dir, lockName), os.O_CREATE | os.O_EXCL | os.O_RDWR, 0644)
+    if os.IsExist(err) {
+        return nil, errLocked
+    }
+    return f, err
+}
+
+func unlockDir(dir string, lock *os.File) {
+    _ = lock.Close()
+    _ = os.Remove(filepath.Join(dir, lockName))
+}
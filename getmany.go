@@ -0,0 +1,55 @@
+package goffkv
+
+import (
+    "sync"
+)
+
+const (
+    // Gets the fallback GetMany runs at once.
+    getManyParallelism = 8
+)
+
+// Result of reading one key with GetMany.
+type GetResult struct {
+    Ver Version
+    Value []byte
+    // OpErrNoEntry if there is no such key, or whatever else reading the key failed with.
+    Err error
+}
+
+// Implemented by backends that can read several keys in one round trip.
+type BatchGetter interface {
+    GetMany(keys []string) ([]GetResult, error)
+}
+
+// Reads every key of keys, returning a result for each, in the same order. Fails as a whole only if
+// some key is invalid, before anything is read.
+//
+// Backends that do not implement BatchGetter are read with concurrent calls to c.Get, so the
+// results are not a consistent snapshot; use CommitRead for one.
+func GetMany(c Client, keys []string) ([]GetResult, error) {
+    for _, key := range keys {
+        if _, err := DisassembleKey(key); err != nil {
+            return nil, err
+        }
+    }
+    if bg, ok := c.(BatchGetter); ok {
+        return bg.GetMany(keys)
+    }
+
+    result := make([]GetResult, len(keys))
+    sem := make(chan struct{}, getManyParallelism)
+    var wg sync.WaitGroup
+    for i, key := range keys {
+        wg.Add(1)
+        sem <- struct{}{}
+        go func(i int, key string) {
+            defer wg.Done()
+            r := &result[i]
+            r.Ver, r.Value, _, r.Err = c.Get(key, false)
+            <-sem
+        }(i, key)
+    }
+    wg.Wait()
+    return result, nil
+}
@@ -0,0 +1,77 @@
+package goffkv_test
+
+import (
+    "bytes"
+    "fmt"
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+)
+
+func testGetMany(t *testing.T, client goffkv.Client) {
+    _ = client.Erase("/config", 0)
+    defer client.Erase("/config", 0)
+
+    _, err := client.Create("/config", nil, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keys := []string{}
+    vers := []goffkv.Version{}
+    for i := 0; i < 20; i++ {
+        key := fmt.Sprintf("/config/%d", i)
+        keys = append(keys, key)
+        if i % 5 == 4 {
+            vers = append(vers, 0)
+            continue
+        }
+        ver, err := client.Create(key, []byte(key), false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        vers = append(vers, ver)
+    }
+
+    result, err := goffkv.GetMany(client, keys)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(result) != len(keys) {
+        t.Fatalf("expected %v results, found %v", len(keys), len(result))
+    }
+    for i, r := range result {
+        if vers[i] == 0 {
+            if r.Err != goffkv.OpErrNoEntry {
+                t.Fatalf("expected goffkv.OpErrNoEntry error for %s, found %v", keys[i], r.Err)
+            }
+            continue
+        }
+        if r.Err != nil {
+            t.Fatal(r.Err)
+        }
+        if r.Ver != vers[i] || !bytes.Equal(r.Value, []byte(keys[i])) {
+            t.Fatalf("unexpected result for %s: %+v", keys[i], r)
+        }
+    }
+
+    _, err = goffkv.GetMany(client, []string{"/config/0", "config"})
+    if _, ok := err.(goffkv.UsageError); !ok {
+        t.Fatalf("expected goffkv.UsageError error, found %v", err)
+    }
+}
+
+func TestGetMany(t *testing.T) {
+    client, err := goffkv.Open("mem://get-many", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        testGetMany(t, client)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        testGetMany(t, plainClient{client})
+    })
+}
@@ -6,4 +6,5 @@ require (
 	github.com/offscale/goffkv-consul v0.0.0-20200406121337-126b968bafd4
 	github.com/offscale/goffkv-etcd v0.0.0-20200406125106-a11dac95a422
 	github.com/offscale/goffkv-zk v0.0.0-20200406121415-12184b0fb54a
+	gopkg.in/yaml.v2 v2.4.0
 )
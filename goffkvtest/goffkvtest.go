@@ -0,0 +1,1393 @@
+// Package goffkvtest is a conformance suite for goffkv.Client implementations.
+package goffkvtest
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    "testing"
+    "bytes"
+    "errors"
+    "time"
+)
+
+// What a backend can or can not do; checks that do not apply are skipped.
+type Capabilities struct {
+    // How long leased keys may outlive the client that created them after it is closed.
+    LeaseExpiry time.Duration
+    // Set if the backend does not support leased keys at all.
+    NoLeases bool
+}
+
+var (
+    // Matches the session TTL of the Consul, ZooKeeper and etcd backends.
+    DefaultCapabilities = Capabilities{LeaseExpiry: 10 * time.Second}
+)
+
+
+type keyHolder struct {
+    keys []string
+    client goffkv.Client
+}
+
+func holdKeys(client goffkv.Client, keys ...string) keyHolder {
+    for _, key := range keys {
+        _ = client.Erase(key, 0)
+    }
+    return keyHolder{keys, client}
+}
+
+func (kh keyHolder) cleanup() {
+    for _, key := range kh.keys {
+        _ = kh.client.Erase(key, 0)
+    }
+}
+
+func generateData() []byte {
+    return []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs")
+}
+
+func CreateExists(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/test")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    ver, watch, err := client.Exists("/test", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver != 0 {
+        t.Fatalf("expected no version (0), found %v", ver)
+    }
+
+    ver, err = client.Create("/test", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, watch, err := client.Exists("/test", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver2 != ver {
+        t.Fatalf("expected version %v, found %v", ver, ver2)
+    }
+}
+
+func CreateGet(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/test")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    _, _, _, err := client.Get("/test", false)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+
+    ver, err := client.Create("/test", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, value2, watch, err := client.Get("/test", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver2 != ver {
+        t.Fatalf("expected version %v, found %v", ver, ver2)
+    }
+    if !bytes.Equal(value2, value) {
+        t.Fatalf("expected value %v, found %v", value, value2)
+    }
+}
+
+func Create(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    _, err := client.Create("/key", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = client.Create("/key", value, false)
+    if err != goffkv.OpErrEntryExists {
+        t.Fatalf("expected goffkv.OpErrEntryExists error, found %v", err)
+    }
+
+    _, err = client.Create("/key/child/grandchild", value, false)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+
+    _, err = client.Create("/key/child", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+func EraseNoKey(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    err := client.Erase("/key", 0)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+}
+
+func EraseExists(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    _, err := client.Create("/key", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = client.Create("/key/child", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    err = client.Erase("/key", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver, watch, err := client.Exists("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver != 0 {
+        t.Fatalf("expected no version (0), found %v", ver)
+    }
+
+    ver, watch, err = client.Exists("/key/child", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver != 0 {
+        t.Fatalf("expected no version (0), found %v", ver)
+    }
+}
+
+func EraseVersioned(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    ver, err := client.Create("/key", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    err = client.Erase("/key", ver + 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, watch, err := client.Exists("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver2 != ver {
+        t.Fatalf("expected version %v, found %v", ver, ver2)
+    }
+
+    err = client.Erase("/key", ver)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, watch, err = client.Exists("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver2 != 0 {
+        t.Fatalf("expected no version (0), found %v", ver2)
+    }
+}
+
+func SetGet(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+
+    ver1, err := client.Create("/key", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, err := client.Set("/key", value2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver2 <= ver1 {
+        t.Fatalf("new version (%v) is not greater than old (%v)", ver2, ver1)
+    }
+
+    ver3, value3, watch, err := client.Get("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver3 != ver2 {
+        t.Fatalf("expected version %v, found %v", ver2, ver3)
+    }
+    if !bytes.Equal(value2, value3) {
+        t.Fatalf("expected value %v, found %v", value2, value3)
+    }
+}
+
+func SetGetHot(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    _, err := client.Set("/key/child", value)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+
+    _, err = client.Set("/key/child/grandchild", value)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+
+    _, err = client.Set("/key", value)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, value2, watch, err := client.Get("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if !bytes.Equal(value2, value) {
+        t.Fatalf("expected value %v, found %v", value, value2)
+    }
+}
+
+func ChildrenNoKey(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    _, _, err := client.Children("/key", false)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+}
+
+func stringSetsEqual(a []string, b []string) bool {
+    m := make(map[string]int)
+    for _, s := range a {
+        m[s]++
+    }
+    for _, s := range b {
+        m[s]--
+    }
+    for _, v := range m {
+        if v != 0 {
+            return false
+        }
+    }
+    return true
+}
+
+func Children(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    keys := []string{
+        "/key",
+        "/key/child",
+        "/key/child/grandchild",
+        "/key/hi",
+    }
+    for _, key := range keys {
+        _, err := client.Create(key, value, false)
+        if err != nil {
+            t.Fatalf("cannot create key %v: %v", key, err)
+        }
+    }
+
+    result, watch, err := client.Children("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+
+    expected := []string{"/key/child", "/key/hi"}
+    if !stringSetsEqual(expected, result) {
+        t.Fatalf("expected children list %v, found %v", expected, result)
+    }
+
+    result, watch, err = client.Children("/key/child", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+
+    expected = []string{"/key/child/grandchild"}
+    if !stringSetsEqual(expected, result) {
+        t.Fatalf("expected children list %v, found %v", expected, result)
+    }
+}
+
+func CasNoKey(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    _, err := client.Cas("/key", value, 42)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+}
+
+func Cas(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+
+    ver, err := client.Create("/key", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, err := client.Cas("/key", value2, ver + 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver2 != 0 {
+        t.Fatalf("expected no version (0), found %v", ver2)
+    }
+
+    ver3, value3, watch, err := client.Get("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver3 != ver {
+        t.Fatalf("expected version %v, found %v", ver, ver3)
+    }
+    if !bytes.Equal(value3, value1) {
+        t.Fatalf("expected value %v, found %v", value2, value1)
+    }
+
+    ver4, err := client.Cas("/key", value2, ver)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver4 <= ver {
+        t.Fatalf("new version (%v) is not greater than old (%v)", ver4, ver)
+    }
+
+    ver5, value5, watch, err := client.Get("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver5 != ver4 {
+        t.Fatalf("expected version %v, found %v", ver4, ver5)
+    }
+    if !bytes.Equal(value5, value2) {
+        t.Fatalf("expected value %v, found %v", value2, value5)
+    }
+}
+
+func CasZeroVersion(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+
+    ver1, err := client.Cas("/key", value1, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver1 == 0 {
+        t.Fatalf("expected non-zero version")
+    }
+
+    ver3, value3, watch, err := client.Get("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver3 != ver1 {
+        t.Fatalf("expected version %v, found %v", ver1, ver3)
+    }
+    if !bytes.Equal(value3, value1) {
+        t.Fatalf("expected value %v, found %v", value1, value3)
+    }
+
+    ver4, err := client.Cas("/key", value2, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver4 != 0 {
+        t.Fatalf("expected no version (0), found %v", ver4)
+    }
+
+    ver5, value5, watch, err := client.Get("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver5 != ver1 {
+        t.Fatalf("expected version %v, found %v", ver1, ver5)
+    }
+    if !bytes.Equal(value5, value1) {
+        t.Fatalf("expected value %v, found %v", value1, value5)
+    }
+}
+
+func TxnSuccess(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/foo")
+    defer kh.cleanup()
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+    value3 := []byte("wcsymfouyanlzcpeorctcczblrezecov")
+
+    ver1, err := client.Create("/foo", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, err := client.Create("/foo/bar", value2, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    result, err := client.Commit(goffkv.Txn{
+        Checks: []goffkv.Check{
+            goffkv.Check{Key: "/foo", Ver: ver1},
+            goffkv.Check{Key: "/foo/bar", Ver: ver2},
+        },
+        Ops: []goffkv.Operation{
+            goffkv.Operation{
+                What: goffkv.Create,
+                Key: "/foo/child",
+                Value: value3,
+                Lease: false,
+            },
+            goffkv.Operation{
+                What: goffkv.Erase,
+                Key: "/foo/bar",
+            },
+        },
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(result) != 1 {
+        t.Fatalf("expected result of length 1, got %v", result)
+    }
+    if result[0].What != goffkv.Create {
+        t.Fatalf("expected result[0].What == goffkv.Create, found %v", result[0].What)
+    }
+
+    ver4, value4, watch, err := client.Get("/foo/child", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver4 != result[0].Ver {
+        t.Fatalf("version mismatch: txn result was %v, get result is %v", result[0].Ver, ver4)
+    }
+    if !bytes.Equal(value4, value3) {
+        t.Fatalf("value mismatch: txn set %v, get result is %v", value3, value4)
+    }
+
+    ver5, watch, err := client.Exists("/foo/bar", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver5 != 0 {
+        t.Fatalf("expected no version (0), found %v", ver5)
+    }
+}
+
+func TxnFailureCheck(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key", "/foo")
+    defer kh.cleanup()
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+    value3 := []byte("wcsymfouyanlzcpeorctcczblrezecov")
+
+    ver1, err := client.Create("/key", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, err := client.Create("/foo", value2, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver3, err := client.Create("/foo/bar", value3, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = client.Commit(goffkv.Txn{
+        Checks: []goffkv.Check{
+            goffkv.Check{Key: "/key", Ver: ver1},
+            goffkv.Check{Key: "/foo", Ver: ver2 + 1},
+            goffkv.Check{Key: "/foo/bar", Ver: ver3},
+        },
+        Ops: []goffkv.Operation{
+            goffkv.Operation{
+                What: goffkv.Create,
+                Key: "/key/child",
+                Value: value1,
+                Lease: false,
+            },
+            goffkv.Operation{
+                What: goffkv.Set,
+                Key: "/key",
+                Value: value2,
+            },
+            goffkv.Operation{
+                What: goffkv.Erase,
+                Key: "/foo",
+            },
+        },
+    })
+
+    txnerr, ok := err.(goffkv.TxnError)
+    if !ok {
+        t.Fatalf("expected goffkv.TxnError error, found %v", err)
+    }
+
+    if txnerr.OpIndex != 1 {
+        t.Fatalf("expected txnerr.OpIndex == 1, found %v", txnerr.OpIndex)
+    }
+
+    ver4, watch, err := client.Exists("/key/child", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver4 != 0 {
+        t.Fatalf("expected no version (0), found %v", ver4)
+    }
+
+    ver5, watch, err := client.Exists("/foo", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver5 == 0 {
+        t.Fatalf("expected non-zero version")
+    }
+
+    _, value6, watch, err := client.Get("/foo", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if !bytes.Equal(value6, value2) {
+        t.Fatalf("expected value %v, found %v", value2, value6)
+    }
+}
+
+func TxnFailureOp(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key", "/foo")
+    defer kh.cleanup()
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+    value3 := []byte("wcsymfouyanlzcpeorctcczblrezecov")
+
+    ver1, err := client.Create("/key", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, err := client.Create("/foo", value2, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver3, err := client.Create("/foo/bar", value3, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = client.Commit(goffkv.Txn{
+        Checks: []goffkv.Check{
+            goffkv.Check{Key: "/key", Ver: ver1},
+            goffkv.Check{Key: "/foo", Ver: ver2},
+            goffkv.Check{Key: "/foo/bar", Ver: ver3},
+        },
+        Ops: []goffkv.Operation{
+            goffkv.Operation{
+                What: goffkv.Create,
+                Key: "/key/child",
+                Value: value1,
+                Lease: false,
+            },
+            goffkv.Operation{
+                What: goffkv.Set,
+                Key: "/key/child2/grandchild",
+                Value: value2,
+            },
+            goffkv.Operation{
+                What: goffkv.Erase,
+                Key: "/foo",
+            },
+        },
+    })
+
+    txnerr, ok := err.(goffkv.TxnError)
+    if !ok {
+        t.Fatalf("expected goffkv.TxnError error, found %v", err)
+    }
+
+    if txnerr.OpIndex != 4 {
+        t.Fatalf("expected txnerr.OpIndex == 4, found %v", txnerr.OpIndex)
+    }
+
+    ver4, watch, err := client.Exists("/key/child", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver4 != 0 {
+        t.Fatalf("expected no version (0), found %v", ver4)
+    }
+
+    ver5, watch, err := client.Exists("/foo", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if ver5 == 0 {
+        t.Fatalf("expected non-zero version")
+    }
+
+    _, value6, watch, err := client.Get("/foo", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if !bytes.Equal(value6, value2) {
+        t.Fatalf("expected value %v, found %v", value2, value6)
+    }
+}
+
+func TxnFailureDetailed(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key", "/foo")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    ver1, err := client.Create("/key", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver2, err := client.Create("/foo", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    cases := []struct {
+        txn goffkv.Txn
+        opIndex int
+        reason goffkv.OpError
+        key string
+        observed goffkv.Version
+    }{
+        {
+            txn: goffkv.Txn{
+                Checks: []goffkv.Check{
+                    goffkv.Check{Key: "/key", Ver: ver1},
+                    goffkv.Check{Key: "/foo", Ver: ver2 + 1},
+                },
+            },
+            opIndex: 1,
+            reason: goffkv.OpErrVersionMismatch,
+            key: "/foo",
+            observed: ver2,
+        },
+        {
+            txn: goffkv.Txn{
+                Checks: []goffkv.Check{
+                    goffkv.Check{Key: "/key/child", Ver: 0},
+                },
+            },
+            opIndex: 0,
+            reason: goffkv.OpErrNoEntry,
+            key: "/key/child",
+        },
+        {
+            txn: goffkv.Txn{
+                Checks: []goffkv.Check{
+                    goffkv.Check{Key: "/key", Ver: ver1},
+                },
+                Ops: []goffkv.Operation{
+                    goffkv.Operation{What: goffkv.Create, Key: "/key/child", Value: value},
+                    goffkv.Operation{What: goffkv.Create, Key: "/foo", Value: value},
+                },
+            },
+            opIndex: 2,
+            reason: goffkv.OpErrEntryExists,
+            key: "/foo",
+        },
+        {
+            txn: goffkv.Txn{
+                Ops: []goffkv.Operation{
+                    goffkv.Operation{What: goffkv.Set, Key: "/key/child2/grandchild", Value: value},
+                },
+            },
+            opIndex: 0,
+            reason: goffkv.OpErrNoEntry,
+            key: "/key/child2/grandchild",
+        },
+        {
+            txn: goffkv.Txn{
+                Ops: []goffkv.Operation{
+                    goffkv.Operation{What: goffkv.Erase, Key: "/foo/bar"},
+                },
+            },
+            opIndex: 0,
+            reason: goffkv.OpErrNoEntry,
+            key: "/foo/bar",
+        },
+    }
+
+    for _, c := range cases {
+        _, err := goffkv.CommitDetailed(client, c.txn)
+        f, ok := err.(goffkv.TxnFailure)
+        if !ok {
+            t.Fatalf("expected goffkv.TxnFailure error, found %v", err)
+        }
+        if f.OpIndex != c.opIndex {
+            t.Fatalf("expected OpIndex == %v, found %v", c.opIndex, f.OpIndex)
+        }
+        if f.Reason != c.reason {
+            t.Fatalf("expected reason %v, found %v", c.reason, f.Reason)
+        }
+        if f.Key != c.key {
+            t.Fatalf("expected key %q, found %q", c.key, f.Key)
+        }
+        if f.Observed != c.observed {
+            t.Fatalf("expected observed version %v, found %v", c.observed, f.Observed)
+        }
+    }
+
+    ver3, _, err := client.Exists("/key/child", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver3 != 0 {
+        t.Fatalf("expected no version (0), found %v", ver3)
+    }
+}
+
+func TxnRead(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key", "/foo")
+    defer kh.cleanup()
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+
+    ver1, err := client.Create("/key", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = client.Create("/key/a", nil, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ver2, err := client.Create("/foo", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    result, err := goffkv.CommitRead(client, goffkv.Txn{
+        Checks: []goffkv.Check{
+            goffkv.Check{Key: "/key", Ver: ver1},
+        },
+        Ops: []goffkv.Operation{
+            goffkv.Operation{What: goffkv.Get, Key: "/key"},
+            goffkv.Operation{What: goffkv.Exists, Key: "/foo/bar"},
+            goffkv.Operation{What: goffkv.Set, Key: "/foo", Value: value2},
+            goffkv.Operation{What: goffkv.Get, Key: "/foo"},
+            goffkv.Operation{What: goffkv.Create, Key: "/key/b", Value: value2},
+            goffkv.Operation{What: goffkv.Children, Key: "/key"},
+        },
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(result) != 6 {
+        t.Fatalf("expected 6 results, found %v", len(result))
+    }
+    if result[0].What != goffkv.Get || result[0].Ver != ver1 || !bytes.Equal(result[0].Value, value1) {
+        t.Fatalf("unexpected result of get: %+v", result[0])
+    }
+    if result[1].What != goffkv.Exists || result[1].Ver != 0 {
+        t.Fatalf("unexpected result of exists: %+v", result[1])
+    }
+    if result[2].What != goffkv.Set || result[2].Ver == 0 {
+        t.Fatalf("unexpected result of set: %+v", result[2])
+    }
+    if result[3].Ver != ver2 || !bytes.Equal(result[3].Value, value1) {
+        t.Fatalf("expected get to see the value before the set, found %+v", result[3])
+    }
+    if result[4].What != goffkv.Create || result[4].Ver == 0 {
+        t.Fatalf("unexpected result of create: %+v", result[4])
+    }
+    if !stringSetsEqual(result[5].Children, []string{"/key/a"}) {
+        t.Fatalf("expected children [/key/a], found %v", result[5].Children)
+    }
+
+    ver3, value3, _, err := client.Get("/foo", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver3 != result[2].Ver || !bytes.Equal(value3, value2) {
+        t.Fatalf("expected value %v at version %v, found %v at %v", value2, result[2].Ver, value3, ver3)
+    }
+
+    _, err = goffkv.CommitRead(client, goffkv.Txn{
+        Ops: []goffkv.Operation{
+            goffkv.Operation{What: goffkv.Set, Key: "/foo", Value: value1},
+            goffkv.Operation{What: goffkv.Get, Key: "/foo/bar"},
+        },
+    })
+    f, ok := err.(goffkv.TxnFailure)
+    if !ok {
+        t.Fatalf("expected goffkv.TxnFailure error, found %v", err)
+    }
+    if f.OpIndex != 1 || f.Reason != goffkv.OpErrNoEntry || f.Key != "/foo/bar" {
+        t.Fatalf("unexpected failure %v", f)
+    }
+
+    _, err = goffkv.CommitRead(client, goffkv.Txn{
+        Checks: []goffkv.Check{
+            goffkv.Check{Key: "/key", Ver: ver1 + 1},
+        },
+        Ops: []goffkv.Operation{
+            goffkv.Operation{What: goffkv.Children, Key: "/foo/bar"},
+        },
+    })
+    f, ok = err.(goffkv.TxnFailure)
+    if !ok {
+        t.Fatalf("expected goffkv.TxnFailure error, found %v", err)
+    }
+    if f.OpIndex != 0 || f.Reason != goffkv.OpErrVersionMismatch {
+        t.Fatalf("unexpected failure %v", f)
+    }
+
+    ver4, _, _, err := client.Get("/foo", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver4 != ver3 {
+        t.Fatalf("expected version %v, found %v", ver3, ver4)
+    }
+}
+
+func TxnPredicates(t *testing.T, client goffkv.Client) {
+    kh := holdKeys(client, "/key", "/foo")
+    defer kh.cleanup()
+
+    _, detailed := client.(goffkv.DetailedCommitter)
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+
+    ver1, err := client.Create("/key", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = client.Create("/key/a", nil, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    txn := goffkv.Txn{
+        Checks: []goffkv.Check{
+            goffkv.Check{Key: "/key", Ver: ver1},
+        },
+        Ops: []goffkv.Operation{
+            goffkv.Operation{What: goffkv.Create, Key: "/key/b", Value: value2},
+            goffkv.Operation{What: goffkv.Create, Key: "/foo", Value: value2},
+        },
+    }
+    preds := []goffkv.Predicate{
+        goffkv.Predicate{Key: "/key", Kind: goffkv.PredExists},
+        goffkv.Predicate{Key: "/key", Kind: goffkv.PredValue, Value: value1},
+        goffkv.Predicate{Key: "/key", Kind: goffkv.PredNumChildren, NumChildren: 1},
+        goffkv.Predicate{Key: "/key/b", Kind: goffkv.PredAbsent},
+    }
+    if !detailed {
+        // Absence can not be checked, so nothing is committed.
+        _, err := goffkv.CommitDetailed(client, txn, preds...)
+        var usageErr goffkv.UsageError
+        if !errors.As(err, &usageErr) {
+            t.Fatalf("expected goffkv.UsageError, found %v", err)
+        }
+        ver, _, err := client.Exists("/foo", false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if ver != 0 {
+            t.Fatalf("expected /foo not to be created")
+        }
+        preds = preds[:3]
+    }
+    result, err := goffkv.CommitDetailed(client, txn, preds...)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(result) != 2 {
+        t.Fatalf("expected 2 results, found %v", len(result))
+    }
+
+    ver2, _, err := client.Exists("/foo", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver2 != result[1].Ver {
+        t.Fatalf("expected version %v, found %v", result[1].Ver, ver2)
+    }
+
+    cases := []struct {
+        pred goffkv.Predicate
+        reason goffkv.OpError
+        observed goffkv.Version
+    }{
+        {goffkv.Predicate{Key: "/key/c", Kind: goffkv.PredExists}, goffkv.OpErrNoEntry, 0},
+        {goffkv.Predicate{Key: "/key", Kind: goffkv.PredValue, Value: value2}, goffkv.OpErrValueMismatch, ver1},
+        {goffkv.Predicate{Key: "/key/c", Kind: goffkv.PredValue}, goffkv.OpErrNoEntry, 0},
+        {goffkv.Predicate{Key: "/key", Kind: goffkv.PredNumChildren, NumChildren: 1}, goffkv.OpErrNumChildrenMismatch, ver1},
+    }
+    if detailed {
+        cases = append(cases, struct {
+            pred goffkv.Predicate
+            reason goffkv.OpError
+            observed goffkv.Version
+        }{goffkv.Predicate{Key: "/key/b", Kind: goffkv.PredAbsent}, goffkv.OpErrEntryExists, result[0].Ver})
+    }
+    for _, c := range cases {
+        _, err := goffkv.CommitDetailed(client, goffkv.Txn{
+            Checks: []goffkv.Check{
+                goffkv.Check{Key: "/key", Ver: ver1},
+            },
+            Ops: []goffkv.Operation{
+                goffkv.Operation{What: goffkv.Set, Key: "/key", Value: value2},
+            },
+        }, c.pred, goffkv.Predicate{Key: "/foo/bar", Kind: goffkv.PredExists})
+        f, ok := err.(goffkv.TxnFailure)
+        if !ok {
+            t.Fatalf("expected goffkv.TxnFailure error, found %v", err)
+        }
+        if f.OpIndex != 1 || f.Reason != c.reason || f.Key != c.pred.Key || f.Observed != c.observed {
+            t.Fatalf("unexpected failure %v of predicate %+v", f, c.pred)
+        }
+    }
+
+    // /key has got another child since.
+    _, err = goffkv.CommitDetailed(client, txn, preds...)
+    f, ok := err.(goffkv.TxnFailure)
+    if !ok {
+        t.Fatalf("expected goffkv.TxnFailure error, found %v", err)
+    }
+    if f.OpIndex != 3 || f.Reason != goffkv.OpErrNumChildrenMismatch {
+        t.Fatalf("unexpected failure %v", f)
+    }
+
+    ver3, value3, _, err := client.Get("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver3 != ver1 || !bytes.Equal(value3, value1) {
+        t.Fatalf("expected value %v at version %v, found %v at %v", value1, ver1, value3, ver3)
+    }
+}
+
+const (
+    maxLag = time.Second
+    watchUsefulCheckTimeout = time.Second * 2
+)
+
+func testWaitSignal(t *testing.T, wait func(), signal func(), checkUseful bool) {
+    c := make(chan struct{})
+
+    go func() {
+        wait()
+        close(c)
+    }()
+
+    if checkUseful {
+        select {
+        case <-c:
+            t.Fatalf("wait() returned before actual signal")
+        case <-time.After(watchUsefulCheckTimeout):
+        }
+    }
+    signal()
+    select {
+    case <-time.After(maxLag):
+        t.Fatalf("timeout reached before wait() returned")
+    case <-c:
+    }
+}
+
+func WatchExists(t *testing.T, client goffkv.Client, checkUseful bool) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    _, err := client.Create("/key", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver, watch, err := client.Exists("/key", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver == 0 {
+        t.Fatalf("expected non-zero version")
+    }
+
+    testWaitSignal(t, watch, func() {
+        err := client.Erase("/key", 0)
+        if err != nil {
+            t.Fatal(err)
+        }
+    }, checkUseful)
+
+    ver, _, err = client.Exists("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver != 0 {
+        t.Fatalf("expected no version (0), found %v", ver)
+    }
+}
+
+func WatchGet(t *testing.T, client goffkv.Client, checkUseful bool) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value1 := []byte("bvdvqdbuujcyynjeuxywzzqsnjvliyua")
+    value2 := []byte("ltljebrisknzmnprimnybqagdqmzasbg")
+
+    _, err := client.Create("/key", value1, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, _, watch, err := client.Get("/key", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    testWaitSignal(t, watch, func() {
+        _, err := client.Set("/key", value2)
+        if err != nil {
+            t.Fatal(err)
+        }
+    }, checkUseful)
+
+    _, value3, _, err := client.Get("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(value3, value2) {
+        t.Fatalf("expected value %v, found %v", value2, value3)
+    }
+}
+
+func WatchChildren(t *testing.T, client goffkv.Client, checkUseful bool) {
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    value := generateData()
+
+    keys := []string{
+        "/key",
+        "/key/child",
+        "/key/child/grandchild",
+        "/key/hi",
+    }
+    for _, key := range keys {
+        _, err := client.Create(key, value, false)
+        if err != nil {
+            t.Fatalf("cannot create key %v: %v", key, err)
+        }
+    }
+
+    result, watch, err := client.Children("/key", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := []string{"/key/child", "/key/hi"}
+    if !stringSetsEqual(result, expected) {
+        t.Fatalf("expected children set %v, found %v", expected, result)
+    }
+
+    testWaitSignal(t, watch, func() {
+        err := client.Erase("/key/hi", 0)
+        if err != nil {
+            t.Fatal(err)
+        }
+    }, checkUseful)
+
+    result, _, err = client.Children("/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected = []string{"/key/child"}
+    if !stringSetsEqual(result, expected) {
+        t.Fatalf("expected children set %v, found %v", expected, result)
+    }
+}
+
+func CreateLeased(t *testing.T, client goffkv.Client, newClient func() goffkv.Client, caps Capabilities) {
+    if caps.NoLeases {
+        t.Skip("backend does not support leased keys")
+    }
+
+    kh := holdKeys(client, "/key")
+    defer kh.cleanup()
+
+    client2 := newClient()
+    if client2 == nil {
+        t.Fatal("cannot open second client")
+    }
+
+    value := generateData()
+
+    _, err := client2.Create("/key", value, true)
+    if err != nil {
+        client2.Close()
+        t.Fatal(err)
+    }
+
+    ver, _, err := client.Exists("/key", false)
+    if err != nil {
+        client2.Close()
+        t.Fatal(err)
+    }
+    if ver == 0 {
+        client2.Close()
+        t.Fatalf("expected non-zero version")
+    }
+
+    client2.Close()
+
+    deadline := time.Now().Add(caps.LeaseExpiry + maxLag)
+    for {
+        ver, _, err = client.Exists("/key", false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if ver == 0 {
+            return
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("expected no version (0), found %v", ver)
+        }
+        time.Sleep(maxLag / 10)
+    }
+}
+
+// Runs the whole suite against clients returned by newClient, assuming DefaultCapabilities.
+func RunConformance(t *testing.T, newClient func() goffkv.Client) {
+    RunConformanceWith(t, newClient, DefaultCapabilities)
+}
+
+// Runs the whole suite against clients returned by newClient. A nil client fails the test.
+func RunConformanceWith(t *testing.T, newClient func() goffkv.Client, caps Capabilities) {
+    client := newClient()
+    if client == nil {
+        t.Fatal("cannot open client")
+    }
+    defer client.Close()
+
+    t.Run("create_exists", func(t *testing.T) {
+        CreateExists(t, client)
+    })
+
+    t.Run("create_get", func(t *testing.T) {
+        CreateGet(t, client)
+    })
+
+    t.Run("create", func(t *testing.T) {
+        Create(t, client)
+    })
+
+    t.Run("erase_no_key", func(t *testing.T) {
+        EraseNoKey(t, client)
+    })
+
+    t.Run("erase_exists", func(t *testing.T) {
+        EraseExists(t, client)
+    })
+
+    t.Run("erase_versioned", func(t *testing.T) {
+        EraseVersioned(t, client)
+    })
+
+    t.Run("set_get", func(t *testing.T) {
+        SetGet(t, client)
+    })
+
+    t.Run("set_get_hot", func(t *testing.T) {
+        SetGetHot(t, client)
+    })
+
+    t.Run("children_no_key", func(t *testing.T) {
+        ChildrenNoKey(t, client)
+    })
+
+    t.Run("children", func(t *testing.T) {
+        Children(t, client)
+    })
+
+    t.Run("cas_no_key", func(t *testing.T) {
+        CasNoKey(t, client)
+    })
+
+    t.Run("cas", func(t *testing.T) {
+        Cas(t, client)
+    })
+
+    t.Run("cas_zero_version", func(t *testing.T) {
+        CasZeroVersion(t, client)
+    })
+
+    t.Run("txn_success", func(t *testing.T) {
+        TxnSuccess(t, client)
+    })
+
+    t.Run("txn_failure_check", func(t *testing.T) {
+        TxnFailureCheck(t, client)
+    })
+
+    t.Run("txn_failure_op", func(t *testing.T) {
+        TxnFailureOp(t, client)
+    })
+
+    t.Run("txn_failure_detailed", func(t *testing.T) {
+        TxnFailureDetailed(t, client)
+    })
+
+    t.Run("txn_read", func(t *testing.T) {
+        TxnRead(t, client)
+    })
+
+    t.Run("txn_predicates", func(t *testing.T) {
+        TxnPredicates(t, client)
+    })
+
+    t.Run("watch_exists", func(t *testing.T) {
+        WatchExists(t, client, false)
+    })
+
+    t.Run("watch_exists_useful", func(t *testing.T) {
+        WatchExists(t, client, true)
+    })
+
+    t.Run("watch_get", func(t *testing.T) {
+        WatchGet(t, client, false)
+    })
+
+    t.Run("watch_get_useful", func(t *testing.T) {
+        WatchGet(t, client, true)
+    })
+
+    t.Run("watch_children", func(t *testing.T) {
+        WatchChildren(t, client, false)
+    })
+
+    t.Run("watch_children_useful", func(t *testing.T) {
+        WatchChildren(t, client, true)
+    })
+
+    t.Run("create_leased", func(t *testing.T) {
+        CreateLeased(t, client, newClient, caps)
+    })
+}
@@ -0,0 +1,414 @@
+package httpkv
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+const (
+    // How long a request may take before the client gives up with goffkv.ErrTimeout.
+    requestTimeout = 10 * time.Second
+    // The least interval between heartbeats, and between attempts to reconnect the watch stream.
+    minInterval = 10 * time.Millisecond
+)
+
+var (
+    errClientClosed = goffkv.ErrSessionExpired.Wrap(errors.New("client is closed"))
+    errInvalidAction = errors.New("httpkv: action not supported by Commit")
+    errInvalidPredicate = errors.New("httpkv: invalid predicate kind")
+    errOwner = errors.New("httpkv: explicit leases are not supported")
+)
+
+type httpClient struct {
+    // The URL of the session.
+    base string
+    ttl time.Duration
+    http *http.Client
+    // Canceled once the client is closed or its session has expired; stops the heartbeat and the
+    // watch stream.
+    ctx context.Context
+    cancel func()
+
+    mu sync.Mutex
+    // Set once the client can not be used anymore.
+    err error
+    closed bool
+    // Watches returned to the user and not fired yet.
+    waiting map[uint64]chan struct{}
+    // Watches fired before they were returned to the user.
+    early map[uint64]bool
+}
+
+// Opens a session on the goffkv-server listening at address (host:port). Leased keys are bound
+// to the session, which the client keeps alive until it is closed.
+//
+// Errors other than goffkv's ones the server reports, such as usage errors the client could not
+// foresee, are returned as plain errors.
+func New(address string, prefix string) (goffkv.Client, error) {
+    if _, err := goffkv.DisassemblePath(prefix); err != nil {
+        return nil, err
+    }
+    c := &httpClient{
+        http: &http.Client{Timeout: requestTimeout},
+        waiting: make(map[uint64]chan struct{}),
+        early: make(map[uint64]bool),
+    }
+    root := "http://" + address + "/v1/sessions"
+    var resp sessionResponse
+    if err := c.post(root, sessionRequest{Prefix: prefix}, &resp); err != nil {
+        return nil, err
+    }
+    if resp.TTL <= 0 {
+        return nil, fmt.Errorf("httpkv: server granted a session TTL of %d ms", resp.TTL)
+    }
+    c.base = root + "/" + resp.Session
+    c.ttl = time.Duration(resp.TTL) * time.Millisecond
+    c.ctx, c.cancel = context.WithCancel(context.Background())
+
+    go c.heartbeat()
+    go c.stream()
+    return c, nil
+}
+
+func connError(err error) error {
+    var netErr net.Error
+    if errors.As(err, &netErr) && netErr.Timeout() {
+        return goffkv.ErrTimeout.Wrap(err)
+    }
+    return goffkv.ErrConnectionLoss.Wrap(err)
+}
+
+// Returns the error a failed response stands for.
+func responseError(r *http.Response) error {
+    var resp errorResponse
+    if err := json.NewDecoder(r.Body).Decode(&resp); err != nil || resp.Error.Kind == "" {
+        return goffkv.ErrConnectionLoss.Wrap(fmt.Errorf("HTTP status %s", r.Status))
+    }
+    e := resp.Error
+    switch e.Kind {
+    case kindOp, kindConn:
+        for _, c := range errorCodes {
+            if c.code == e.Code {
+                return c.err
+            }
+        }
+        if e.Kind == kindConn {
+            return goffkv.ErrConnectionLoss.Wrap(errors.New(e.Message))
+        }
+    case kindTxn:
+        if e.OpIndex == nil {
+            break
+        }
+        txnErr := goffkv.TxnError{OpIndex: *e.OpIndex}
+        for _, c := range errorCodes {
+            if reason, ok := c.err.(goffkv.OpError); ok && c.code == e.Code {
+                return goffkv.TxnFailure{TxnError: txnErr, Reason: reason, Key: e.Key, Observed: e.Observed}
+            }
+        }
+        // The server could not tell why.
+        return txnErr
+    }
+    return errors.New("httpkv: " + e.Message)
+}
+
+func (c *httpClient) post(url string, req interface{}, resp interface{}) error {
+    data, err := json.Marshal(req)
+    if err != nil {
+        return err
+    }
+    r, err := c.http.Post(url, "application/json", bytes.NewReader(data))
+    if err != nil {
+        return connError(err)
+    }
+    defer r.Body.Close()
+    if r.StatusCode != http.StatusOK {
+        return responseError(r)
+    }
+    if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+        return connError(err)
+    }
+    return nil
+}
+
+// Makes a request on the session.
+func (c *httpClient) call(op string, req interface{}, resp interface{}) error {
+    c.mu.Lock()
+    err := c.err
+    c.mu.Unlock()
+    if err != nil {
+        return err
+    }
+
+    err = c.post(c.base + "/" + op, req, resp)
+    if errors.Is(err, goffkv.ErrSessionExpired) {
+        c.end(err)
+    }
+    return err
+}
+
+// Makes the client unusable, failing further operations with err, and wakes all the watches.
+func (c *httpClient) end(err error) {
+    c.mu.Lock()
+    if c.err == nil {
+        c.err = err
+    }
+    c.mu.Unlock()
+    c.cancel()
+    c.wakeAll()
+}
+
+// Returns how often the session is kept alive.
+func (c *httpClient) interval() time.Duration {
+    if c.ttl / 3 < minInterval {
+        return minInterval
+    }
+    return c.ttl / 3
+}
+
+func (c *httpClient) heartbeat() {
+    ticker := time.NewTicker(c.interval())
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            // Other failures are retried on the next tick, while the session may still be alive.
+            _ = c.call("keepalive", struct{}{}, &struct{}{})
+        case <-c.ctx.Done():
+            return
+        }
+    }
+}
+
+// Fires the watches as the server reports them, reconnecting to the server until the client is
+// done.
+func (c *httpClient) stream() {
+    for {
+        err := c.readStream()
+        // Events may have been lost with the connection; waking watches spuriously is harmless.
+        c.wakeAll()
+        if errors.Is(err, goffkv.ErrSessionExpired) {
+            c.end(err)
+            return
+        }
+        select {
+        case <-time.After(c.interval()):
+        case <-c.ctx.Done():
+            return
+        }
+    }
+}
+
+func (c *httpClient) readStream() error {
+    req, err := http.NewRequest(http.MethodGet, c.base + "/watches", nil)
+    if err != nil {
+        return err
+    }
+    // The stream lasts as long as the session, so it must not time out as requests do.
+    r, err := http.DefaultClient.Do(req.WithContext(c.ctx))
+    if err != nil {
+        return connError(err)
+    }
+    defer r.Body.Close()
+    if r.StatusCode != http.StatusOK {
+        return responseError(r)
+    }
+
+    dec := json.NewDecoder(r.Body)
+    for {
+        var ev wireEvent
+        if err := dec.Decode(&ev); err != nil {
+            return connError(err)
+        }
+        c.fire(ev.Watch)
+    }
+}
+
+func (c *httpClient) fire(id uint64) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if ch, ok := c.waiting[id]; ok {
+        delete(c.waiting, id)
+        close(ch)
+    } else {
+        c.early[id] = true
+    }
+}
+
+func (c *httpClient) wakeAll() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    for id, ch := range c.waiting {
+        delete(c.waiting, id)
+        close(ch)
+    }
+}
+
+func (c *httpClient) watchOf(id uint64) goffkv.Watch {
+    if id == 0 {
+        return nil
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    ch := make(chan struct{})
+    if c.early[id] {
+        delete(c.early, id)
+        close(ch)
+    } else if c.err != nil {
+        // The client ended while the watch was being set.
+        close(ch)
+    } else {
+        c.waiting[id] = ch
+    }
+    return func() {
+        <-ch
+    }
+}
+
+func (c *httpClient) keyOp(op string, req keyRequest) (keyResponse, error) {
+    var resp keyResponse
+    if _, err := goffkv.DisassembleKey(req.Key); err != nil {
+        return resp, err
+    }
+    err := c.call(op, req, &resp)
+    return resp, err
+}
+
+func (c *httpClient) Create(key string, value []byte, lease bool) (goffkv.Version, error) {
+    resp, err := c.keyOp("create", keyRequest{Key: key, Value: value, Lease: lease})
+    return resp.Ver, err
+}
+
+func (c *httpClient) Set(key string, value []byte) (goffkv.Version, error) {
+    resp, err := c.keyOp("set", keyRequest{Key: key, Value: value})
+    return resp.Ver, err
+}
+
+func (c *httpClient) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    resp, err := c.keyOp("cas", keyRequest{Key: key, Value: value, Ver: ver})
+    return resp.Ver, err
+}
+
+func (c *httpClient) Erase(key string, ver goffkv.Version) error {
+    _, err := c.keyOp("erase", keyRequest{Key: key, Ver: ver})
+    return err
+}
+
+func (c *httpClient) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    resp, err := c.keyOp("exists", keyRequest{Key: key, Watch: watch})
+    if err != nil {
+        return 0, nil, err
+    }
+    return resp.Ver, c.watchOf(resp.Watch), nil
+}
+
+func (c *httpClient) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    resp, err := c.keyOp("get", keyRequest{Key: key, Watch: watch})
+    if err != nil {
+        return 0, nil, nil, err
+    }
+    return resp.Ver, resp.Value, c.watchOf(resp.Watch), nil
+}
+
+func (c *httpClient) Children(key string, watch bool) ([]string, goffkv.Watch, error) {
+    resp, err := c.keyOp("children", keyRequest{Key: key, Watch: watch})
+    if err != nil {
+        return nil, nil, err
+    }
+    children := resp.Children
+    if children == nil {
+        children = []string{}
+    }
+    return children, c.watchOf(resp.Watch), nil
+}
+
+func (c *httpClient) Commit(txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    result, err := c.CommitDetailed(txn, nil)
+    if f, ok := err.(goffkv.TxnFailure); ok {
+        return nil, f.TxnError
+    }
+    return result, err
+}
+
+func (c *httpClient) CommitDetailed(txn goffkv.Txn, preds []goffkv.Predicate) ([]goffkv.TxnOpResult, error) {
+    req := commitRequest{}
+    for _, check := range txn.Checks {
+        if _, err := goffkv.DisassembleKey(check.Key); err != nil {
+            return nil, err
+        }
+        req.Checks = append(req.Checks, wireCheck{Key: check.Key, Ver: check.Ver})
+    }
+    for _, pred := range preds {
+        if _, err := goffkv.DisassembleKey(pred.Key); err != nil {
+            return nil, err
+        }
+        kind, ok := predicateKinds[pred.Kind]
+        if !ok {
+            return nil, errInvalidPredicate
+        }
+        req.Predicates = append(req.Predicates, wirePredicate{
+            Key: pred.Key,
+            Kind: kind,
+            Value: pred.Value,
+            NumChildren: pred.NumChildren,
+        })
+    }
+    for _, op := range txn.Ops {
+        if _, err := goffkv.DisassembleKey(op.Key); err != nil {
+            return nil, err
+        }
+        what, ok := actions[op.What]
+        if !ok {
+            return nil, errInvalidAction
+        }
+        if op.Owner != nil {
+            return nil, errOwner
+        }
+        req.Ops = append(req.Ops, wireOp{What: what, Key: op.Key, Value: op.Value, Lease: op.Lease})
+    }
+
+    var resp commitResponse
+    if err := c.call("commit", req, &resp); err != nil {
+        return nil, err
+    }
+    results := []goffkv.TxnOpResult{}
+    for _, result := range resp.Results {
+        what, _ := parseAction(result.What)
+        results = append(results, goffkv.TxnOpResult{What: what, Ver: result.Ver})
+    }
+    return results, nil
+}
+
+// Ends the session, erasing its leased keys.
+func (c *httpClient) Close() {
+    c.mu.Lock()
+    if c.closed {
+        c.mu.Unlock()
+        return
+    }
+    c.closed = true
+    c.mu.Unlock()
+
+    c.end(errClientClosed)
+    req, err := http.NewRequest(http.MethodDelete, c.base, nil)
+    if err != nil {
+        return
+    }
+    if r, err := c.http.Do(req); err == nil {
+        r.Body.Close()
+    }
+}
+
+func init() {
+    goffkv.RegisterClient("goffkv+http", New)
+}
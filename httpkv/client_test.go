@@ -0,0 +1,86 @@
+package httpkv_test
+
+import (
+    "errors"
+    goffkv "github.com/offscale/goffkv"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestClientHeartbeat(t *testing.T) {
+    server, _ := newServer(t, 300 * time.Millisecond)
+    defer server.Close()
+    // Drops the heartbeats once dropping is set.
+    var dropping int32
+    ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if atomic.LoadInt32(&dropping) != 0 && strings.HasSuffix(r.URL.Path, "/keepalive") {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        server.ServeHTTP(w, r)
+    }))
+    defer ts.Close()
+
+    client, err := goffkv.Open("goffkv+http://" + strings.TrimPrefix(ts.URL, "http://"), "/app")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+    observer, err := goffkv.Open("mem://httpkv", "/prefix/app")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer observer.Close()
+
+    erase(t, "/app/leased", "/app/key")
+    if _, err := client.Create("/leased", []byte("value"), true); err != nil {
+        t.Fatal(err)
+    }
+    _, watch, err := client.Exists("/leased", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    time.Sleep(time.Second)
+    if ver, _, err := observer.Exists("/leased", false); err != nil || ver == 0 {
+        t.Fatalf("leased key erased while the client was alive (error %v)", err)
+    }
+
+    atomic.StoreInt32(&dropping, 1)
+    fired := make(chan struct{})
+    go func() {
+        watch()
+        close(fired)
+    }()
+    select {
+    case <-fired:
+    case <-time.After(2 * time.Second):
+        t.Fatalf("watch not fired once the session expired")
+    }
+    if ver, _, err := observer.Exists("/leased", false); err != nil || ver != 0 {
+        t.Fatalf("leased key survived its session (error %v)", err)
+    }
+
+    // The client notices the expiry through its watch stream.
+    time.Sleep(200 * time.Millisecond)
+    if _, err := client.Set("/key", nil); !errors.Is(err, goffkv.ErrSessionExpired) {
+        t.Fatalf("expected ErrSessionExpired, found %v", err)
+    }
+}
+
+func TestClientInvalidTTL(t *testing.T) {
+    ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        _, _ = w.Write([]byte(`{"session": "s", "ttl": 0}`))
+    }))
+    defer ts.Close()
+
+    client, err := goffkv.Open("goffkv+http://" + strings.TrimPrefix(ts.URL, "http://"), "")
+    if err == nil {
+        client.Close()
+        t.Fatalf("expected a session TTL of 0 to be rejected")
+    }
+}
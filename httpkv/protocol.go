@@ -0,0 +1,193 @@
+// Package httpkv serves a goffkv.Client over HTTP/JSON, and registers the "goffkv+http" scheme
+// (goffkv+http://host:port) of clients talking to such a server, so that backends can be used
+// without linking them.
+//
+// Every client of the server opens a session first, with its own prefix below the server's one:
+//
+//     POST   /v1/sessions                 {"prefix": "/app", "ttl": 10000}  -> {"session": "<id>", "ttl": 10000}
+//     POST   /v1/sessions/<id>/keepalive  {}                                -> {}
+//     DELETE /v1/sessions/<id>                                              -> {}
+//
+// The server opens a backend client for each session and closes it, erasing its leased keys, once
+// no request has been made on the session for its TTL, in milliseconds. The TTL defaults to, and
+// may not exceed, the server's one. Every request on a session counts as a heartbeat.
+//
+// The operations of Client are made with POST /v1/sessions/<id>/<op>, values being base64 in JSON:
+//
+//     create    {"key": "/k", "value": "dmFs", "lease": true}    -> {"ver": 1}
+//     set       {"key": "/k", "value": "dmFs"}                   -> {"ver": 2}
+//     cas       {"key": "/k", "value": "dmFs", "ver": 2}         -> {"ver": 3}, or {} on mismatch
+//     erase     {"key": "/k", "ver": 3}                          -> {}
+//     exists    {"key": "/k", "watch": true}                     -> {"ver": 3, "watch": 1}, {} if absent
+//     get       {"key": "/k", "watch": true}                     -> {"ver": 3, "value": "dmFs", "watch": 2}
+//     children  {"key": "/k", "watch": true}                     -> {"children": ["/k/a"], "watch": 3}
+//     commit    {"checks": [{"key": "/k", "ver": 3}],
+//                "predicates": [{"key": "/k/a", "kind": "absent"}],
+//                "ops": [{"what": "set", "key": "/k", "value": "dmFs"}]}
+//                                                               -> {"results": [{"what": "set", "ver": 4}]}
+//
+// Predicate kinds are "exists", "absent", "value" and "num_children", with "value" and
+// "num_children" fields, checked as by goffkv.CommitDetailed; actions are "create", "set" and
+// "erase".
+//
+// Watches are numbered per session. GET /v1/sessions/<id>/watches streams the fired ones as JSON
+// lines, {"watch": 1, "kind": "changed", "key": "/k", "ver": 4}, kinds being those of
+// goffkv.EventKind; the stream ends once the session does. A session should have one stream.
+//
+// Failures are reported with a non-2xx status and a body such as
+//
+//     {"error": {"kind": "op", "code": "no_entry", "message": "get \"/k\": no entry"}}
+//
+// kind being "usage", "op", "txn" (with "op_index", "key" and "observed" fields, as in
+// goffkv.TxnFailure), "conn" or "internal". Codes are
+// "no_entry", "entry_exists", "ephem", "version_mismatch", "value_mismatch" and
+// "num_children_mismatch" for op and txn errors, and "connection_loss", "session_expired" and
+// "timeout" for conn errors.
+package httpkv
+
+import (
+    "errors"
+    goffkv "github.com/offscale/goffkv"
+)
+
+type sessionRequest struct {
+    Prefix string `json:"prefix,omitempty"`
+    TTL int64 `json:"ttl,omitempty"`
+}
+
+type sessionResponse struct {
+    Session string `json:"session"`
+    TTL int64 `json:"ttl"`
+}
+
+type keyRequest struct {
+    Key string `json:"key"`
+    Value []byte `json:"value,omitempty"`
+    Lease bool `json:"lease,omitempty"`
+    Ver goffkv.Version `json:"ver,omitempty"`
+    Watch bool `json:"watch,omitempty"`
+}
+
+type keyResponse struct {
+    Ver goffkv.Version `json:"ver,omitempty"`
+    Value []byte `json:"value,omitempty"`
+    Children []string `json:"children,omitempty"`
+    Watch uint64 `json:"watch,omitempty"`
+}
+
+type wireCheck struct {
+    Key string `json:"key"`
+    Ver goffkv.Version `json:"ver,omitempty"`
+}
+
+type wirePredicate struct {
+    Key string `json:"key"`
+    Kind string `json:"kind"`
+    Value []byte `json:"value,omitempty"`
+    NumChildren int `json:"num_children,omitempty"`
+}
+
+type wireOp struct {
+    What string `json:"what"`
+    Key string `json:"key"`
+    Value []byte `json:"value,omitempty"`
+    Lease bool `json:"lease,omitempty"`
+}
+
+type commitRequest struct {
+    Checks []wireCheck `json:"checks,omitempty"`
+    Predicates []wirePredicate `json:"predicates,omitempty"`
+    Ops []wireOp `json:"ops,omitempty"`
+}
+
+type wireResult struct {
+    What string `json:"what"`
+    Ver goffkv.Version `json:"ver"`
+}
+
+type commitResponse struct {
+    Results []wireResult `json:"results"`
+}
+
+type wireEvent struct {
+    Watch uint64 `json:"watch"`
+    Kind string `json:"kind"`
+    Key string `json:"key"`
+    Ver goffkv.Version `json:"ver,omitempty"`
+}
+
+type wireError struct {
+    Kind string `json:"kind"`
+    Code string `json:"code,omitempty"`
+    Message string `json:"message"`
+    OpIndex *int `json:"op_index,omitempty"`
+    Key string `json:"key,omitempty"`
+    Observed goffkv.Version `json:"observed,omitempty"`
+}
+
+type errorResponse struct {
+    Error wireError `json:"error"`
+}
+
+const (
+    kindUsage = "usage"
+    kindOp = "op"
+    kindTxn = "txn"
+    kindConn = "conn"
+    kindInternal = "internal"
+)
+
+var (
+    predicateKinds = map[goffkv.PredicateKind]string{
+        goffkv.PredExists: "exists",
+        goffkv.PredAbsent: "absent",
+        goffkv.PredValue: "value",
+        goffkv.PredNumChildren: "num_children",
+    }
+    actions = map[goffkv.Action]string{
+        goffkv.Create: "create",
+        goffkv.Set: "set",
+        goffkv.Erase: "erase",
+    }
+    errorCodes = []struct {
+        code string
+        err error
+    }{
+        {"no_entry", goffkv.OpErrNoEntry},
+        {"entry_exists", goffkv.OpErrEntryExists},
+        {"ephem", goffkv.OpErrEphem},
+        {"version_mismatch", goffkv.OpErrVersionMismatch},
+        {"value_mismatch", goffkv.OpErrValueMismatch},
+        {"num_children_mismatch", goffkv.OpErrNumChildrenMismatch},
+        {"connection_loss", goffkv.ErrConnectionLoss},
+        {"session_expired", goffkv.ErrSessionExpired},
+        {"timeout", goffkv.ErrTimeout},
+    }
+)
+
+func errorCode(err error) string {
+    for _, c := range errorCodes {
+        if errors.Is(err, c.err) {
+            return c.code
+        }
+    }
+    return ""
+}
+
+func parsePredicateKind(name string) (goffkv.PredicateKind, bool) {
+    for kind, n := range predicateKinds {
+        if n == name {
+            return kind, true
+        }
+    }
+    return 0, false
+}
+
+func parseAction(name string) (goffkv.Action, bool) {
+    for what, n := range actions {
+        if n == name {
+            return what, true
+        }
+    }
+    return 0, false
+}
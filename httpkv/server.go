@@ -0,0 +1,434 @@
+package httpkv
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+const (
+    maxRequestSize = 64 << 20
+)
+
+var (
+    errNoSession = goffkv.ErrSessionExpired.Wrap(errors.New("no such session"))
+    errInvalidTTL = errors.New("httpkv: invalid TTL")
+)
+
+// An http.Handler serving the protocol described in the package documentation.
+type Server struct {
+    url string
+    prefix string
+    ttl time.Duration
+
+    mu sync.Mutex
+    sessions map[string]*session
+    closed bool
+}
+
+type session struct {
+    id string
+    client goffkv.Client
+    ttl time.Duration
+    timer *time.Timer
+    // Closed once the session has ended.
+    done chan struct{}
+
+    mu sync.Mutex
+    lastWatch uint64
+    // Fired watches not streamed yet.
+    fired []wireEvent
+    notify chan struct{}
+}
+
+// Returns a server opening the clients of its sessions with goffkv.Open(url, prefix + the session's
+// prefix). Sessions end after ttl without requests, unless they ask for a shorter TTL. As TTLs are
+// reported in milliseconds, ttl must be at least one.
+func NewServer(url string, prefix string, ttl time.Duration) (*Server, error) {
+    if ttl < time.Millisecond {
+        return nil, errInvalidTTL
+    }
+    // Fail early on a bad URL or prefix.
+    client, err := goffkv.Open(url, prefix)
+    if err != nil {
+        return nil, err
+    }
+    client.Close()
+
+    return &Server{
+        url: url,
+        prefix: prefix,
+        ttl: ttl,
+        sessions: make(map[string]*session),
+    }, nil
+}
+
+// Ends all the sessions; new ones can not be opened anymore.
+func (s *Server) Close() {
+    s.mu.Lock()
+    s.closed = true
+    sessions := []*session{}
+    for _, sess := range s.sessions {
+        sessions = append(sessions, sess)
+    }
+    s.mu.Unlock()
+
+    for _, sess := range sessions {
+        s.end(sess)
+    }
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    path := strings.TrimPrefix(r.URL.Path, "/v1/sessions")
+    if path == r.URL.Path || (path != "" && path[0] != '/') {
+        fail(w, http.StatusNotFound, "not found")
+        return
+    }
+    parts := strings.Split(strings.Trim(path, "/"), "/")
+    switch {
+    case parts[0] == "":
+        if r.Method != http.MethodPost {
+            fail(w, http.StatusMethodNotAllowed, "method not allowed")
+            return
+        }
+        s.open(w, r)
+    case len(parts) <= 2:
+        s.mu.Lock()
+        sess, ok := s.sessions[parts[0]]
+        s.mu.Unlock()
+        if !ok {
+            writeError(w, errNoSession)
+            return
+        }
+        if len(parts) == 1 {
+            if r.Method != http.MethodDelete {
+                fail(w, http.StatusMethodNotAllowed, "method not allowed")
+                return
+            }
+            s.end(sess)
+            reply(w, struct{}{})
+            return
+        }
+        s.serveOp(w, r, sess, parts[1])
+    default:
+        fail(w, http.StatusNotFound, "not found")
+    }
+}
+
+func (s *Server) open(w http.ResponseWriter, r *http.Request) {
+    var req sessionRequest
+    if err := decode(w, r, &req); err != nil {
+        fail(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if _, err := goffkv.DisassemblePath(req.Prefix); err != nil {
+        writeError(w, err)
+        return
+    }
+    ttl := s.ttl
+    if req.TTL < 0 {
+        fail(w, http.StatusBadRequest, errInvalidTTL.Error())
+        return
+    }
+    if d := time.Duration(req.TTL) * time.Millisecond; d != 0 && d < ttl {
+        ttl = d
+    }
+
+    id, err := newID()
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    client, err := goffkv.Open(s.url, s.prefix + req.Prefix)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    sess := &session{
+        id: id,
+        client: client,
+        ttl: ttl,
+        done: make(chan struct{}),
+        notify: make(chan struct{}, 1),
+    }
+
+    s.mu.Lock()
+    if s.closed {
+        s.mu.Unlock()
+        client.Close()
+        fail(w, http.StatusServiceUnavailable, "server is closed")
+        return
+    }
+    s.sessions[id] = sess
+    sess.timer = time.AfterFunc(ttl, func() {
+        s.end(sess)
+    })
+    s.mu.Unlock()
+
+    reply(w, sessionResponse{Session: id, TTL: int64(ttl / time.Millisecond)})
+}
+
+func newID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
+
+// Closes the client of the session, unless it has ended already.
+func (s *Server) end(sess *session) {
+    s.mu.Lock()
+    if s.sessions[sess.id] != sess {
+        s.mu.Unlock()
+        return
+    }
+    delete(s.sessions, sess.id)
+    s.mu.Unlock()
+
+    sess.timer.Stop()
+    close(sess.done)
+    sess.client.Close()
+}
+
+func (s *Server) serveOp(w http.ResponseWriter, r *http.Request, sess *session, op string) {
+    if op == "watches" {
+        if r.Method != http.MethodGet {
+            fail(w, http.StatusMethodNotAllowed, "method not allowed")
+            return
+        }
+        sess.stream(w, r)
+        return
+    }
+    if r.Method != http.MethodPost {
+        fail(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    // Resetting a timer that has fired already only makes it call end once more, which does nothing.
+    sess.timer.Reset(sess.ttl)
+
+    switch op {
+    case "keepalive":
+        reply(w, struct{}{})
+    case "create", "set", "cas", "erase", "exists", "get", "children":
+        var req keyRequest
+        if err := decode(w, r, &req); err != nil {
+            fail(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        resp, err := sess.keyOp(op, req)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        reply(w, resp)
+    case "commit":
+        var req commitRequest
+        if err := decode(w, r, &req); err != nil {
+            fail(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        txn, preds, err := txnOf(req)
+        if err != nil {
+            fail(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        results, err := goffkv.CommitDetailed(sess.client, txn, preds...)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        resp := commitResponse{Results: []wireResult{}}
+        for _, result := range results {
+            resp.Results = append(resp.Results, wireResult{What: actions[result.What], Ver: result.Ver})
+        }
+        reply(w, resp)
+    default:
+        fail(w, http.StatusNotFound, "unknown operation")
+    }
+}
+
+func (sess *session) keyOp(op string, req keyRequest) (keyResponse, error) {
+    c := sess.client
+    resp := keyResponse{}
+    var events <-chan goffkv.WatchEvent
+    var err error
+    switch op {
+    case "create":
+        resp.Ver, err = c.Create(req.Key, req.Value, req.Lease)
+    case "set":
+        resp.Ver, err = c.Set(req.Key, req.Value)
+    case "cas":
+        resp.Ver, err = c.Cas(req.Key, req.Value, req.Ver)
+    case "erase":
+        err = c.Erase(req.Key, req.Ver)
+    case "exists":
+        if req.Watch {
+            resp.Ver, events, err = goffkv.ExistsEvents(c, req.Key)
+        } else {
+            resp.Ver, _, err = c.Exists(req.Key, false)
+        }
+    case "get":
+        if req.Watch {
+            resp.Ver, resp.Value, events, err = goffkv.GetEvents(c, req.Key)
+        } else {
+            resp.Ver, resp.Value, _, err = c.Get(req.Key, false)
+        }
+    case "children":
+        if req.Watch {
+            resp.Children, events, err = goffkv.ChildrenEvents(c, req.Key)
+        } else {
+            resp.Children, _, err = c.Children(req.Key, false)
+        }
+    }
+    if err == nil && events != nil {
+        resp.Watch = sess.watch(events)
+    }
+    return resp, err
+}
+
+func txnOf(req commitRequest) (goffkv.Txn, []goffkv.Predicate, error) {
+    txn := goffkv.Txn{}
+    for _, check := range req.Checks {
+        txn.Checks = append(txn.Checks, goffkv.Check{Key: check.Key, Ver: check.Ver})
+    }
+    preds := []goffkv.Predicate{}
+    for _, pred := range req.Predicates {
+        kind, ok := parsePredicateKind(pred.Kind)
+        if !ok {
+            return goffkv.Txn{}, nil, errors.New("unknown predicate kind " + pred.Kind)
+        }
+        preds = append(preds, goffkv.Predicate{
+            Key: pred.Key,
+            Kind: kind,
+            Value: pred.Value,
+            NumChildren: pred.NumChildren,
+        })
+    }
+    for _, op := range req.Ops {
+        what, ok := parseAction(op.What)
+        if !ok {
+            return goffkv.Txn{}, nil, errors.New("unknown action " + op.What)
+        }
+        txn.Ops = append(txn.Ops, goffkv.Operation{What: what, Key: op.Key, Value: op.Value, Lease: op.Lease})
+    }
+    return txn, preds, nil
+}
+
+// Numbers the watch and queues its event for the stream once it fires.
+func (sess *session) watch(events <-chan goffkv.WatchEvent) uint64 {
+    sess.mu.Lock()
+    sess.lastWatch++
+    id := sess.lastWatch
+    sess.mu.Unlock()
+
+    go func() {
+        select {
+        case ev := <-events:
+            sess.mu.Lock()
+            sess.fired = append(sess.fired, wireEvent{Watch: id, Kind: ev.Kind.String(), Key: ev.Key, Ver: ev.Ver})
+            sess.mu.Unlock()
+            select {
+            case sess.notify <- struct{}{}:
+            default:
+            }
+        case <-sess.done:
+        }
+    }()
+    return id
+}
+
+func (sess *session) stream(w http.ResponseWriter, r *http.Request) {
+    flusher, _ := w.(http.Flusher)
+    enc := json.NewEncoder(w)
+    send := func() error {
+        sess.mu.Lock()
+        fired := sess.fired
+        sess.fired = nil
+        sess.mu.Unlock()
+        for _, ev := range fired {
+            if err := enc.Encode(ev); err != nil {
+                return err
+            }
+        }
+        if flusher != nil {
+            flusher.Flush()
+        }
+        return nil
+    }
+
+    w.Header().Set("Content-Type", "application/x-ndjson")
+    w.WriteHeader(http.StatusOK)
+    for {
+        if err := send(); err != nil {
+            return
+        }
+        select {
+        case <-sess.notify:
+        case <-sess.done:
+            _ = send()
+            return
+        case <-r.Context().Done():
+            return
+        }
+    }
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+    err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v)
+    if err == io.EOF {
+        // An empty body stands for {}.
+        return nil
+    }
+    return err
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(v)
+}
+
+func fail(w http.ResponseWriter, status int, msg string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(errorResponse{wireError{Kind: kindUsage, Message: msg}})
+}
+
+func writeError(w http.ResponseWriter, err error) {
+    e := wireError{Kind: kindInternal, Code: errorCode(err), Message: err.Error()}
+    status := http.StatusInternalServerError
+    var txnErr goffkv.TxnError
+    var f goffkv.TxnFailure
+    var opErr goffkv.OpError
+    var usageErr goffkv.UsageError
+    var connErr goffkv.ConnError
+    switch {
+    case errors.As(err, &txnErr):
+        e.Kind, e.OpIndex, status = kindTxn, &txnErr.OpIndex, http.StatusConflict
+        if errors.As(err, &f) {
+            e.Key, e.Observed = f.Key, f.Observed
+        }
+    case errors.As(err, &opErr):
+        e.Kind, status = kindOp, http.StatusConflict
+        if e.Code == "no_entry" {
+            status = http.StatusNotFound
+        }
+    case errors.As(err, &usageErr):
+        e.Kind, status = kindUsage, http.StatusBadRequest
+    case errors.As(err, &connErr):
+        e.Kind, status = kindConn, http.StatusServiceUnavailable
+        if e.Code == "session_expired" {
+            status = http.StatusGone
+        }
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(errorResponse{e})
+}
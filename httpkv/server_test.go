@@ -0,0 +1,198 @@
+package httpkv_test
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    goffkv "github.com/offscale/goffkv"
+    "github.com/offscale/goffkv/httpkv"
+    _ "github.com/offscale/goffkv/mem"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+type object = map[string]interface{}
+
+func newServer(t *testing.T, ttl time.Duration) (*httpkv.Server, *httptest.Server) {
+    server, err := httpkv.NewServer("mem://httpkv", "/prefix", ttl)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return server, httptest.NewServer(server)
+}
+
+// Posts body to path and decodes the response, expecting the given status.
+func post(t *testing.T, url string, body object, status int) object {
+    data, err := json.Marshal(body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    result := object{}
+    if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != status {
+        t.Fatalf("POST %s: expected status %d, found %d: %v", url, status, resp.StatusCode, result)
+    }
+    return result
+}
+
+// Erases keys left by earlier runs.
+func erase(t *testing.T, keys ...string) {
+    client, err := goffkv.Open("mem://httpkv", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+    for _, key := range keys {
+        _ = client.Erase(key, 0)
+    }
+}
+
+func openSession(t *testing.T, base string, body object) string {
+    return base + "/v1/sessions/" + post(t, base + "/v1/sessions", body, http.StatusOK)["session"].(string)
+}
+
+func expectError(t *testing.T, result object, kind string, code string) {
+    e, _ := result["error"].(object)
+    if e["kind"] != kind || (code != "" && e["code"] != code) {
+        t.Fatalf("expected %s error %q, found %v", kind, code, result)
+    }
+}
+
+func TestServer(t *testing.T) {
+    server, ts := newServer(t, time.Minute)
+    defer ts.Close()
+    defer server.Close()
+    erase(t, "/app/key", "/app/other")
+
+    s := openSession(t, ts.URL, object{"prefix": "/app"})
+    value := []byte("value")
+
+    ver := post(t, s + "/create", object{"key": "/key", "value": value}, http.StatusOK)["ver"]
+    if ver == nil {
+        t.Fatalf("no version returned by create")
+    }
+    expectError(t, post(t, s + "/create", object{"key": "/key"}, http.StatusConflict), "op", "entry_exists")
+    expectError(t, post(t, s + "/get", object{"key": "/missing"}, http.StatusNotFound), "op", "no_entry")
+    expectError(t, post(t, s + "/get", object{"key": "bad"}, http.StatusBadRequest), "usage", "")
+
+    result := post(t, s + "/get", object{"key": "/key"}, http.StatusOK)
+    if result["ver"] != ver || result["value"] != "dmFsdWU=" {
+        t.Fatalf("unexpected get result %v", result)
+    }
+    if result := post(t, s + "/cas", object{"key": "/key", "value": value, "ver": 1000}, http.StatusOK); result["ver"] != nil {
+        t.Fatalf("cas succeeded with a wrong version: %v", result)
+    }
+
+    // The session's prefix is below the server's one.
+    client, err := goffkv.Open("mem://httpkv", "/prefix/app")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+    if got, _, err := client.Exists("/key", false); err != nil || got != goffkv.Version(ver.(float64)) {
+        t.Fatalf("expected version %v, found %v (error %v)", ver, got, err)
+    }
+
+    result = post(t, s + "/commit", object{
+        "checks": []object{{"key": "/key", "ver": ver}},
+        "predicates": []object{{"key": "/other", "kind": "absent"}},
+        "ops": []object{{"what": "set", "key": "/key", "value": value}, {"what": "create", "key": "/other"}},
+    }, http.StatusOK)
+    if results := result["results"].([]interface{}); len(results) != 2 || results[1].(object)["what"] != "create" {
+        t.Fatalf("unexpected commit result %v", result)
+    }
+    result = post(t, s + "/commit", object{
+        "predicates": []object{{"key": "/key", "kind": "exists"}, {"key": "/other", "kind": "absent"}},
+    }, http.StatusConflict)
+    expectError(t, result, "txn", "entry_exists")
+    if e := result["error"].(object); e["op_index"] != 1.0 || e["key"] != "/other" || e["observed"] == nil {
+        t.Fatalf("expected failure of predicate 1 on /other, found %v", result)
+    }
+    expectError(t, post(t, s + "/commit", object{"ops": []object{{"what": "get", "key": "/key"}}}, http.StatusBadRequest), "usage", "")
+
+    post(t, ts.URL + "/v1/sessions/" + "nosuchsession" + "/keepalive", object{}, http.StatusGone)
+}
+
+func TestServerWatches(t *testing.T) {
+    server, ts := newServer(t, time.Minute)
+    defer ts.Close()
+    defer server.Close()
+    erase(t, "/watched")
+
+    s := openSession(t, ts.URL, object{})
+    resp, err := http.Get(s + "/watches")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    lines := bufio.NewScanner(resp.Body)
+
+    result := post(t, s + "/exists", object{"key": "/watched", "watch": true}, http.StatusOK)
+    if result["ver"] != nil || result["watch"] == nil {
+        t.Fatalf("unexpected exists result %v", result)
+    }
+    post(t, s + "/create", object{"key": "/watched"}, http.StatusOK)
+
+    if !lines.Scan() {
+        t.Fatalf("stream ended before the event: %v", lines.Err())
+    }
+    ev := object{}
+    if err := json.Unmarshal(lines.Bytes(), &ev); err != nil {
+        t.Fatal(err)
+    }
+    if ev["watch"] != result["watch"] || ev["kind"] != "created" || ev["key"] != "/watched" {
+        t.Fatalf("unexpected event %v", ev)
+    }
+
+    req, _ := http.NewRequest(http.MethodDelete, s, nil)
+    deleted, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    deleted.Body.Close()
+    // The stream ends with the session.
+    for lines.Scan() {
+    }
+}
+
+func TestServerSessionExpiry(t *testing.T) {
+    server, ts := newServer(t, time.Minute)
+    defer ts.Close()
+    defer server.Close()
+
+    s1 := openSession(t, ts.URL, object{"ttl": 200})
+    s2 := openSession(t, ts.URL, object{})
+    post(t, s1 + "/create", object{"key": "/leased", "lease": true}, http.StatusOK)
+
+    // Heartbeats keep the session alive.
+    for i := 0; i < 4; i++ {
+        time.Sleep(100 * time.Millisecond)
+        post(t, s1 + "/keepalive", object{}, http.StatusOK)
+    }
+    if post(t, s2 + "/exists", object{"key": "/leased"}, http.StatusOK)["ver"] == nil {
+        t.Fatalf("leased key erased while the session was alive")
+    }
+
+    time.Sleep(500 * time.Millisecond)
+    if result := post(t, s2 + "/exists", object{"key": "/leased"}, http.StatusOK); result["ver"] != nil {
+        t.Fatalf("leased key survived its session: %v", result)
+    }
+    expectError(t, post(t, s1 + "/keepalive", object{}, http.StatusGone), "conn", "session_expired")
+}
+
+func TestServerInvalidTTL(t *testing.T) {
+    for _, ttl := range []time.Duration{0, -time.Second, 500 * time.Microsecond} {
+        if _, err := httpkv.NewServer("mem://httpkv", "/prefix", ttl); err == nil {
+            t.Fatalf("expected TTL %v to be rejected", ttl)
+        }
+    }
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+    "context"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// Operations of the engine never block, so they are either made before the context is done or not
+// at all.
+
+func annotate(err error, op string, key string) error {
+    if e, ok := err.(goffkv.OpError); ok && e.Key == "" {
+        return e.With(op, key)
+    }
+    return err
+}
+
+func (s *Store) removeWatch(watches map[string][]watcher, path string, ch <-chan goffkv.WatchEvent) {
+    kept := watches[path][:0]
+    for _, w := range watches[path] {
+        if w.ch != ch {
+            kept = append(kept, w)
+        }
+    }
+    if len(kept) == 0 {
+        delete(watches, path)
+    } else {
+        watches[path] = kept
+    }
+}
+
+// Returns a Watch of events that also returns once ctx is done, the watch being released then.
+func (c *memClient) watchCtx(ctx context.Context, watches map[string][]watcher, key string, events <-chan goffkv.WatchEvent) goffkv.Watch {
+    if events == nil {
+        return nil
+    }
+    segments, _ := goffkv.DisassembleKey(key)
+    path := c.assemblePath(segments)
+    fired := make(chan struct{})
+    go func() {
+        select {
+        case <-events:
+        case <-ctx.Done():
+            c.s.mu.Lock()
+            c.s.removeWatch(watches, path, events)
+            c.s.mu.Unlock()
+        }
+        close(fired)
+    }()
+    return func() {
+        <-fired
+    }
+}
+
+func (c *memClient) CreateCtx(ctx context.Context, key string, value []byte, lease bool) (goffkv.Version, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    ver, err := c.Create(key, value, lease)
+    return ver, annotate(err, "create", key)
+}
+
+func (c *memClient) SetCtx(ctx context.Context, key string, value []byte) (goffkv.Version, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    ver, err := c.Set(key, value)
+    return ver, annotate(err, "set", key)
+}
+
+func (c *memClient) CasCtx(ctx context.Context, key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    resultVer, err := c.Cas(key, value, ver)
+    return resultVer, annotate(err, "cas", key)
+}
+
+func (c *memClient) EraseCtx(ctx context.Context, key string, ver goffkv.Version) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    return annotate(c.Erase(key, ver), "erase", key)
+}
+
+func (c *memClient) ExistsCtx(ctx context.Context, key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, nil, err
+    }
+    ver, events, err := c.exists(key, watch)
+    return ver, c.watchCtx(ctx, c.s.dataWatches, key, events), annotate(err, "exists", key)
+}
+
+func (c *memClient) GetCtx(ctx context.Context, key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, nil, nil, err
+    }
+    ver, value, events, err := c.get(key, watch)
+    return ver, value, c.watchCtx(ctx, c.s.dataWatches, key, events), annotate(err, "get", key)
+}
+
+func (c *memClient) ChildrenCtx(ctx context.Context, key string, watch bool) ([]string, goffkv.Watch, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, nil, err
+    }
+    result, events, err := c.children(key, watch)
+    return result, c.watchCtx(ctx, c.s.childWatches, key, events), annotate(err, "children", key)
+}
+
+func (c *memClient) CommitCtx(ctx context.Context, txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    return c.Commit(txn)
+}
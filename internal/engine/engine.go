@@ -0,0 +1,973 @@
+// Package engine implements goffkv.Client on top of an in-memory Store, which a Journal can make
+// durable. It backs the mem and file backends.
+package engine
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+)
+
+const (
+    // Events a tree watch may fall behind by before it is reset with goffkv.EventResync.
+    maxTreeQueue = 1024
+)
+
+var (
+    errClosed = goffkv.ErrSessionExpired.Wrap(errors.New("client is closed"))
+    errInvalidPredicate = errors.New("invalid predicate kind")
+)
+
+type node struct {
+    value []byte
+    ver goffkv.Version
+    created goffkv.Version
+    lease *memLease
+    // Next numbers for CreateSequential, by the last segment of the prefix.
+    sequences map[string]uint64
+}
+
+type watcher struct {
+    ch chan goffkv.WatchEvent
+    owner *memClient
+}
+
+type treeWatcher struct {
+    root string
+    owner *memClient
+    queue []goffkv.WatchEvent
+    notify chan struct{}
+    lost bool
+}
+
+// The data, watches and leases shared by the clients of one backend instance.
+type Store struct {
+    mu sync.Mutex
+    rev goffkv.Version
+    nodes map[string]*node
+    children map[string]map[string]struct{}
+    dataWatches map[string][]watcher
+    childWatches map[string][]watcher
+    treeWatches map[*treeWatcher]struct{}
+    // Same as node.sequences, for prefixes of a single segment, by their path.
+    sequences map[string]uint64
+    journal Journal
+}
+
+type memClient struct {
+    s *Store
+    prefixSegments []string
+    session *memLease
+    closed bool
+    onClose func()
+}
+
+func NewStore() *Store {
+    return &Store{
+        nodes: make(map[string]*node),
+        children: make(map[string]map[string]struct{}),
+        dataWatches: make(map[string][]watcher),
+        childWatches: make(map[string][]watcher),
+        treeWatches: make(map[*treeWatcher]struct{}),
+        sequences: make(map[string]uint64),
+    }
+}
+
+// Opens a client of s. onClose, if not nil, is called once the client is closed.
+func NewClient(s *Store, prefix string, onClose func()) (goffkv.Client, error) {
+    prefixSegments, err := goffkv.DisassemblePath(prefix)
+    if err != nil {
+        return nil, err
+    }
+    return &memClient{
+        s: s,
+        prefixSegments: prefixSegments,
+        session: newLease(s, 0),
+        onClose: onClose,
+    }, nil
+}
+
+func (c *memClient) assemblePath(segments []string) string {
+    parts := []string{""}
+    parts = append(parts, c.prefixSegments...)
+    parts = append(parts, segments...)
+    return strings.Join(parts, "/")
+}
+
+func (c *memClient) unwrapPath(path string) string {
+    return path[len(c.assemblePath(nil)):]
+}
+
+func parentOf(path string) string {
+    return path[:strings.LastIndexByte(path, '/')]
+}
+
+type touch struct {
+    path string
+    kind goffkv.EventKind
+    ver goffkv.Version
+}
+
+// A sequence of mutations that is either applied as a whole or rolled back.
+type change struct {
+    s *Store
+    undo []func()
+    touched []touch
+    touchedChildren []touch
+    log []Mutation
+}
+
+func (s *Store) begin() *change {
+    s.rev++
+    return &change{s: s}
+}
+
+func (ch *change) rollback() {
+    for i := len(ch.undo) - 1; i >= 0; i-- {
+        ch.undo[i]()
+    }
+    ch.s.rev--
+}
+
+// Fails, rolling the change back, only if the journal does.
+func (ch *change) commit() error {
+    if err := ch.record(); err != nil {
+        ch.rollback()
+        return err
+    }
+    ch.apply()
+    return nil
+}
+
+func (ch *change) record() error {
+    if ch.s.journal == nil || len(ch.log) == 0 {
+        return nil
+    }
+    return ch.s.journal.Append(Record{Rev: ch.s.rev, Muts: ch.log})
+}
+
+// Notifies the watches.
+func (ch *change) apply() {
+    for _, t := range ch.touched {
+        ch.s.fire(ch.s.dataWatches, t)
+        for tw := range ch.s.treeWatches {
+            if t.path == tw.root || strings.HasPrefix(t.path, tw.root + "/") {
+                tw.enqueue(goffkv.WatchEvent{Kind: t.kind, Key: tw.owner.unwrapPath(t.path), Ver: t.ver})
+            }
+        }
+    }
+    for _, t := range ch.touchedChildren {
+        ch.s.fire(ch.s.childWatches, t)
+    }
+}
+
+func (ch *change) create(c *memClient, segments []string, value []byte, lease *memLease) error {
+    s := ch.s
+    path := c.assemblePath(segments)
+    if _, ok := s.nodes[path]; ok {
+        return goffkv.OpErrEntryExists
+    }
+    parent := parentOf(path)
+    if len(segments) > 1 {
+        p, ok := s.nodes[parent]
+        if !ok {
+            return goffkv.OpErrNoEntry
+        }
+        if p.lease != nil {
+            return goffkv.OpErrEphem
+        }
+    }
+
+    if lease != nil && lease.gone {
+        return errLeaseGone
+    }
+    n := &node{value: value, ver: s.rev, created: s.rev, lease: lease}
+    s.nodes[path] = n
+
+    siblings, ok := s.children[parent]
+    if !ok {
+        siblings = make(map[string]struct{})
+        s.children[parent] = siblings
+    }
+    siblings[path] = struct{}{}
+
+    ch.undo = append(ch.undo, func() {
+        delete(s.nodes, path)
+        delete(siblings, path)
+    })
+    ch.log = append(ch.log, Mutation{Path: path, Value: value, Ver: s.rev, Created: s.rev, Leased: lease != nil})
+    ch.touched = append(ch.touched, touch{path, goffkv.EventCreated, s.rev})
+    ch.touchedChildren = append(ch.touchedChildren, touch{parent, goffkv.EventChildrenChanged, 0})
+    return nil
+}
+
+func (ch *change) set(path string, value []byte) error {
+    n, ok := ch.s.nodes[path]
+    if !ok {
+        return goffkv.OpErrNoEntry
+    }
+    oldValue, oldVer := n.value, n.ver
+    n.value, n.ver = value, ch.s.rev
+    ch.undo = append(ch.undo, func() {
+        n.value, n.ver = oldValue, oldVer
+    })
+    ch.log = append(ch.log, Mutation{Path: path, Value: value, Ver: n.ver, Created: n.created, Leased: n.lease != nil})
+    ch.touched = append(ch.touched, touch{path, goffkv.EventChanged, ch.s.rev})
+    return nil
+}
+
+func (ch *change) erase(path string) error {
+    s := ch.s
+    n, ok := s.nodes[path]
+    if !ok {
+        return goffkv.OpErrNoEntry
+    }
+    for child := range s.children[path] {
+        _ = ch.erase(child)
+    }
+
+    parent := parentOf(path)
+    siblings := s.children[parent]
+    delete(s.nodes, path)
+    delete(siblings, path)
+
+    ch.undo = append(ch.undo, func() {
+        s.nodes[path] = n
+        siblings[path] = struct{}{}
+    })
+    ch.log = append(ch.log, Mutation{Path: path, Erase: true})
+    ch.touched = append(ch.touched, touch{path, goffkv.EventErased, 0})
+    ch.touchedChildren = append(ch.touchedChildren,
+        touch{path, goffkv.EventErased, 0},
+        touch{parent, goffkv.EventChildrenChanged, 0})
+    return nil
+}
+
+// Sets the next number of CreateSequential for the prefix name under parent, or for the prefix
+// with the path name if parent is "".
+func (ch *change) setSequence(sequences map[string]uint64, parent string, name string, next uint64) {
+    old, ok := sequences[name]
+    sequences[name] = next
+    ch.undo = append(ch.undo, func() {
+        if ok {
+            sequences[name] = old
+        } else {
+            delete(sequences, name)
+        }
+    })
+    ch.log = append(ch.log, Mutation{Path: parent, Sequence: name, Next: next})
+}
+
+func (s *Store) fire(watches map[string][]watcher, t touch) {
+    for _, w := range watches[t.path] {
+        w.ch <- goffkv.WatchEvent{Kind: t.kind, Key: w.owner.unwrapPath(t.path), Ver: t.ver}
+        close(w.ch)
+    }
+    delete(watches, t.path)
+}
+
+func (s *Store) addWatch(watches map[string][]watcher, path string, owner *memClient) <-chan goffkv.WatchEvent {
+    ch := make(chan goffkv.WatchEvent, 1)
+    watches[path] = append(watches[path], watcher{ch, owner})
+    return ch
+}
+
+func (tw *treeWatcher) enqueue(ev goffkv.WatchEvent) {
+    if len(tw.queue) >= maxTreeQueue {
+        tw.queue = []goffkv.WatchEvent{{Kind: goffkv.EventResync, Key: tw.owner.unwrapPath(tw.root)}}
+    } else {
+        tw.queue = append(tw.queue, ev)
+    }
+    select {
+    case tw.notify <- struct{}{}:
+    default:
+    }
+}
+
+func watchOf(events <-chan goffkv.WatchEvent) goffkv.Watch {
+    if events == nil {
+        return nil
+    }
+    return func() {
+        <-events
+    }
+}
+
+func (s *Store) dropWatches(watches map[string][]watcher, owner *memClient) {
+    for path, ws := range watches {
+        kept := ws[:0]
+        for _, w := range ws {
+            if w.owner == owner {
+                w.ch <- goffkv.WatchEvent{Kind: goffkv.EventSessionLost, Key: owner.unwrapPath(path)}
+                close(w.ch)
+            } else {
+                kept = append(kept, w)
+            }
+        }
+        if len(kept) == 0 {
+            delete(watches, path)
+        } else {
+            watches[path] = kept
+        }
+    }
+}
+
+func (c *memClient) lock() error {
+    c.s.mu.Lock()
+    if c.closed {
+        c.s.mu.Unlock()
+        return errClosed
+    }
+    return nil
+}
+
+func (c *memClient) unlock() {
+    c.s.mu.Unlock()
+}
+
+func (c *memClient) Create(key string, value []byte, lease bool) (goffkv.Version, error) {
+    var l *memLease
+    if lease {
+        l = c.session
+    }
+    return c.create(key, value, l)
+}
+
+func (c *memClient) create(key string, value []byte, l *memLease) (goffkv.Version, error) {
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return 0, err
+    }
+    if err := c.lock(); err != nil {
+        return 0, err
+    }
+    defer c.unlock()
+
+    ch := c.s.begin()
+    if err := ch.create(c, segments, value, l); err != nil {
+        ch.rollback()
+        return 0, err
+    }
+    if err := ch.commit(); err != nil {
+        return 0, err
+    }
+    return c.s.rev, nil
+}
+
+func (c *memClient) CreateSequential(prefix string, value []byte, lease bool) (string, goffkv.Version, error) {
+    segments, err := goffkv.DisassembleKey(prefix)
+    if err != nil {
+        return "", 0, err
+    }
+    if err := c.lock(); err != nil {
+        return "", 0, err
+    }
+    defer c.unlock()
+
+    var l *memLease
+    if lease {
+        l = c.session
+    }
+
+    path := c.assemblePath(segments)
+    last := len(segments) - 1
+    sequences, parentPath, name := c.s.sequences, "", path
+    if last > 0 {
+        parentPath = c.assemblePath(segments[:last])
+        parent, ok := c.s.nodes[parentPath]
+        if !ok {
+            return "", 0, goffkv.OpErrNoEntry
+        }
+        if parent.sequences == nil {
+            parent.sequences = make(map[string]uint64)
+        }
+        sequences, name = parent.sequences, segments[last]
+    }
+
+    n := sequences[name]
+    for {
+        if _, ok := c.s.nodes[fmt.Sprintf("%s%010d", path, n)]; !ok {
+            break
+        }
+        n++
+    }
+
+    keySegments := append(append([]string{}, segments[:last]...), fmt.Sprintf("%s%010d", segments[last], n))
+    ch := c.s.begin()
+    if err := ch.create(c, keySegments, value, l); err != nil {
+        ch.rollback()
+        return "", 0, err
+    }
+    ch.setSequence(sequences, parentPath, name, n + 1)
+    if err := ch.commit(); err != nil {
+        return "", 0, err
+    }
+    return fmt.Sprintf("%s%010d", prefix, n), c.s.rev, nil
+}
+
+func (c *memClient) Set(key string, value []byte) (goffkv.Version, error) {
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return 0, err
+    }
+    if err := c.lock(); err != nil {
+        return 0, err
+    }
+    defer c.unlock()
+
+    ch := c.s.begin()
+    path := c.assemblePath(segments)
+    if _, ok := c.s.nodes[path]; ok {
+        err = ch.set(path, value)
+    } else {
+        err = ch.create(c, segments, value, nil)
+    }
+    if err != nil {
+        ch.rollback()
+        return 0, err
+    }
+    if err := ch.commit(); err != nil {
+        return 0, err
+    }
+    return c.s.rev, nil
+}
+
+func (c *memClient) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    if ver == 0 {
+        resultVer, err := c.Create(key, value, false)
+        if err == goffkv.OpErrEntryExists {
+            return 0, nil
+        }
+        return resultVer, err
+    }
+
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return 0, err
+    }
+    if err := c.lock(); err != nil {
+        return 0, err
+    }
+    defer c.unlock()
+
+    path := c.assemblePath(segments)
+    n, ok := c.s.nodes[path]
+    if !ok {
+        return 0, goffkv.OpErrNoEntry
+    }
+    if n.ver != ver {
+        return 0, nil
+    }
+
+    ch := c.s.begin()
+    _ = ch.set(path, value)
+    if err := ch.commit(); err != nil {
+        return 0, err
+    }
+    return c.s.rev, nil
+}
+
+func (c *memClient) Erase(key string, ver goffkv.Version) error {
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return err
+    }
+    if err := c.lock(); err != nil {
+        return err
+    }
+    defer c.unlock()
+
+    path := c.assemblePath(segments)
+    n, ok := c.s.nodes[path]
+    if !ok {
+        return goffkv.OpErrNoEntry
+    }
+    if ver != 0 && n.ver != ver {
+        return nil
+    }
+
+    ch := c.s.begin()
+    _ = ch.erase(path)
+    return ch.commit()
+}
+
+func (c *memClient) exists(key string, watch bool) (goffkv.Version, <-chan goffkv.WatchEvent, error) {
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return 0, nil, err
+    }
+    if err := c.lock(); err != nil {
+        return 0, nil, err
+    }
+    defer c.unlock()
+
+    path := c.assemblePath(segments)
+    var resultVer goffkv.Version
+    if n, ok := c.s.nodes[path]; ok {
+        resultVer = n.ver
+    }
+    var events <-chan goffkv.WatchEvent
+    if watch {
+        events = c.s.addWatch(c.s.dataWatches, path, c)
+    }
+    return resultVer, events, nil
+}
+
+func (c *memClient) get(key string, watch bool) (goffkv.Version, []byte, <-chan goffkv.WatchEvent, error) {
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return 0, nil, nil, err
+    }
+    if err := c.lock(); err != nil {
+        return 0, nil, nil, err
+    }
+    defer c.unlock()
+
+    path := c.assemblePath(segments)
+    n, ok := c.s.nodes[path]
+    if !ok {
+        return 0, nil, nil, goffkv.OpErrNoEntry
+    }
+    var events <-chan goffkv.WatchEvent
+    if watch {
+        events = c.s.addWatch(c.s.dataWatches, path, c)
+    }
+    return n.ver, append([]byte(nil), n.value...), events, nil
+}
+
+func (c *memClient) children(key string, watch bool) ([]string, <-chan goffkv.WatchEvent, error) {
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return nil, nil, err
+    }
+    if err := c.lock(); err != nil {
+        return nil, nil, err
+    }
+    defer c.unlock()
+
+    path := c.assemblePath(segments)
+    if _, ok := c.s.nodes[path]; !ok {
+        return nil, nil, goffkv.OpErrNoEntry
+    }
+
+    result := []string{}
+    for child := range c.s.children[path] {
+        result = append(result, c.unwrapPath(child))
+    }
+    var events <-chan goffkv.WatchEvent
+    if watch {
+        events = c.s.addWatch(c.s.childWatches, path, c)
+    }
+    return result, events, nil
+}
+
+func (c *memClient) GetMany(keys []string) ([]goffkv.GetResult, error) {
+    paths := []string{}
+    for _, key := range keys {
+        segments, err := goffkv.DisassembleKey(key)
+        if err != nil {
+            return nil, err
+        }
+        paths = append(paths, c.assemblePath(segments))
+    }
+    if err := c.lock(); err != nil {
+        return nil, err
+    }
+    defer c.unlock()
+
+    result := make([]goffkv.GetResult, len(keys))
+    for i, path := range paths {
+        n, ok := c.s.nodes[path]
+        if !ok {
+            result[i].Err = goffkv.OpErrNoEntry
+            continue
+        }
+        result[i].Ver = n.ver
+        result[i].Value = append([]byte(nil), n.value...)
+    }
+    return result, nil
+}
+
+func (c *memClient) GetTree(root string, opts goffkv.WalkOptions) ([]goffkv.TreeEntry, error) {
+    segments, err := goffkv.DisassembleKey(root)
+    if err != nil {
+        return nil, err
+    }
+    if err := c.lock(); err != nil {
+        return nil, err
+    }
+    defer c.unlock()
+
+    path := c.assemblePath(segments)
+    if _, ok := c.s.nodes[path]; !ok {
+        return nil, goffkv.OpErrNoEntry
+    }
+
+    entries := []goffkv.TreeEntry{}
+    level := []string{path}
+    for depth := 0; len(level) != 0; depth++ {
+        next := []string{}
+        for _, path := range level {
+            n := c.s.nodes[path]
+            entry := goffkv.TreeEntry{Key: c.unwrapPath(path), Ver: n.ver}
+            if !opts.KeysOnly {
+                entry.Value = append([]byte(nil), n.value...)
+            }
+            entries = append(entries, entry)
+
+            if opts.MaxDepth != 0 && depth >= opts.MaxDepth {
+                continue
+            }
+            children := []string{}
+            for child := range c.s.children[path] {
+                children = append(children, child)
+            }
+            sort.Strings(children)
+            next = append(next, children...)
+        }
+        level = next
+    }
+    return entries, nil
+}
+
+func (c *memClient) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    ver, events, err := c.exists(key, watch)
+    return ver, watchOf(events), err
+}
+
+func (c *memClient) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    ver, value, events, err := c.get(key, watch)
+    return ver, value, watchOf(events), err
+}
+
+func (c *memClient) Children(key string, watch bool) ([]string, goffkv.Watch, error) {
+    result, events, err := c.children(key, watch)
+    return result, watchOf(events), err
+}
+
+func (c *memClient) ExistsEvents(key string) (goffkv.Version, <-chan goffkv.WatchEvent, error) {
+    return c.exists(key, true)
+}
+
+func (c *memClient) GetEvents(key string) (goffkv.Version, []byte, <-chan goffkv.WatchEvent, error) {
+    return c.get(key, true)
+}
+
+func (c *memClient) ChildrenEvents(key string) ([]string, <-chan goffkv.WatchEvent, error) {
+    return c.children(key, true)
+}
+
+func (c *memClient) WatchTree(ctx context.Context, path string) (<-chan goffkv.WatchEvent, error) {
+    segments, err := goffkv.DisassemblePath(path)
+    if err != nil {
+        return nil, err
+    }
+    if err := c.lock(); err != nil {
+        return nil, err
+    }
+    tw := &treeWatcher{
+        root: c.assemblePath(segments),
+        owner: c,
+        notify: make(chan struct{}, 1),
+    }
+    c.s.treeWatches[tw] = struct{}{}
+    c.unlock()
+
+    ch := make(chan goffkv.WatchEvent)
+    go c.pumpTree(ctx, tw, ch)
+    return ch, nil
+}
+
+func (c *memClient) pumpTree(ctx context.Context, tw *treeWatcher, ch chan<- goffkv.WatchEvent) {
+    defer close(ch)
+    defer func() {
+        c.s.mu.Lock()
+        delete(c.s.treeWatches, tw)
+        c.s.mu.Unlock()
+    }()
+
+    for {
+        select {
+        case <-tw.notify:
+        case <-ctx.Done():
+            return
+        }
+
+        c.s.mu.Lock()
+        events, lost := tw.queue, tw.lost
+        tw.queue = nil
+        c.s.mu.Unlock()
+
+        for _, ev := range events {
+            select {
+            case ch <- ev:
+            case <-ctx.Done():
+                return
+            }
+        }
+        if lost {
+            return
+        }
+    }
+}
+
+// Returns why the check fails and the version of the key, if it does.
+func (s *Store) check(path string, check goffkv.Check) (goffkv.OpError, goffkv.Version, bool) {
+    n, ok := s.nodes[path]
+    if !ok {
+        return goffkv.OpErrNoEntry, 0, false
+    }
+    if check.Ver != 0 && n.ver != check.Ver {
+        return goffkv.OpErrVersionMismatch, n.ver, false
+    }
+    return goffkv.OpError{}, n.ver, true
+}
+
+// Returns why the predicate fails and the version of the key, if it does.
+func (s *Store) checkPredicate(path string, pred goffkv.Predicate) (goffkv.OpError, goffkv.Version, bool) {
+    n, ok := s.nodes[path]
+    if pred.Kind == goffkv.PredAbsent {
+        if ok {
+            return goffkv.OpErrEntryExists, n.ver, false
+        }
+        return goffkv.OpError{}, 0, true
+    }
+    if !ok {
+        return goffkv.OpErrNoEntry, 0, false
+    }
+    switch pred.Kind {
+    case goffkv.PredValue:
+        if !bytes.Equal(n.value, pred.Value) {
+            return goffkv.OpErrValueMismatch, n.ver, false
+        }
+    case goffkv.PredNumChildren:
+        if len(s.children[path]) != pred.NumChildren {
+            return goffkv.OpErrNumChildrenMismatch, n.ver, false
+        }
+    }
+    return goffkv.OpError{}, n.ver, true
+}
+
+func (c *memClient) Commit(txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    result, err := c.CommitDetailed(txn, nil)
+    if f, ok := err.(goffkv.TxnFailure); ok {
+        return nil, f.TxnError
+    }
+    return result, err
+}
+
+func (c *memClient) CommitDetailed(txn goffkv.Txn, preds []goffkv.Predicate) ([]goffkv.TxnOpResult, error) {
+    results, err := c.CommitRead(txn, preds)
+    if err != nil {
+        return nil, err
+    }
+    result := []goffkv.TxnOpResult{}
+    for _, r := range results {
+        if r.What == goffkv.Create || r.What == goffkv.Set {
+            result = append(result, goffkv.TxnOpResult{What: r.What, Ver: r.Ver})
+        }
+    }
+    return result, nil
+}
+
+func (c *memClient) CommitRead(txn goffkv.Txn, preds []goffkv.Predicate) ([]goffkv.TxnResult, error) {
+    resp, err := c.commitCond(txn, preds, nil, false)
+    return resp.Results, err
+}
+
+func (c *memClient) CommitCond(txn goffkv.Txn, els []goffkv.Operation, preds []goffkv.Predicate) (goffkv.TxnResponse, error) {
+    return c.commitCond(txn, preds, els, true)
+}
+
+func (c *memClient) prepareOps(ops []goffkv.Operation) ([][]string, []*memLease, error) {
+    opSegments := [][]string{}
+    opLeases := []*memLease{}
+    for _, op := range ops {
+        segments, err := goffkv.DisassembleKey(op.Key)
+        if err != nil {
+            return nil, nil, err
+        }
+        opSegments = append(opSegments, segments)
+
+        l, err := c.leaseOf(op.Owner, op.Lease)
+        if err != nil {
+            return nil, nil, err
+        }
+        opLeases = append(opLeases, l)
+    }
+    return opSegments, opLeases, nil
+}
+
+func (c *memClient) commitCond(txn goffkv.Txn, preds []goffkv.Predicate, els []goffkv.Operation, hasElse bool) (goffkv.TxnResponse, error) {
+    checkSegments := [][]string{}
+    for _, check := range txn.Checks {
+        segments, err := goffkv.DisassembleKey(check.Key)
+        if err != nil {
+            return goffkv.TxnResponse{}, err
+        }
+        checkSegments = append(checkSegments, segments)
+    }
+    predSegments := [][]string{}
+    for _, pred := range preds {
+        segments, err := goffkv.DisassembleKey(pred.Key)
+        if err != nil {
+            return goffkv.TxnResponse{}, err
+        }
+        if pred.Kind < goffkv.PredExists || pred.Kind > goffkv.PredNumChildren {
+            return goffkv.TxnResponse{}, errInvalidPredicate
+        }
+        predSegments = append(predSegments, segments)
+    }
+    opSegments, opLeases, err := c.prepareOps(txn.Ops)
+    if err != nil {
+        return goffkv.TxnResponse{}, err
+    }
+    elseSegments, elseLeases, err := c.prepareOps(els)
+    if err != nil {
+        return goffkv.TxnResponse{}, err
+    }
+
+    if err := c.lock(); err != nil {
+        return goffkv.TxnResponse{}, err
+    }
+    defer c.unlock()
+
+    base := len(txn.Checks) + len(preds)
+    fail := func(i int, key string, reason goffkv.OpError, observed goffkv.Version) (goffkv.TxnResponse, error) {
+        if hasElse {
+            result, err := c.run(els, elseSegments, elseLeases, base)
+            return goffkv.TxnResponse{Results: result}, err
+        }
+        return goffkv.TxnResponse{}, goffkv.TxnFailure{
+            TxnError: goffkv.TxnError{OpIndex: i},
+            Reason: reason,
+            Key: key,
+            Observed: observed,
+        }
+    }
+    for i, check := range txn.Checks {
+        path := c.assemblePath(checkSegments[i])
+        if reason, observed, ok := c.s.check(path, check); !ok {
+            return fail(i, check.Key, reason, observed)
+        }
+    }
+    for j, pred := range preds {
+        path := c.assemblePath(predSegments[j])
+        if reason, observed, ok := c.s.checkPredicate(path, pred); !ok {
+            return fail(len(txn.Checks) + j, pred.Key, reason, observed)
+        }
+    }
+
+    result, err := c.run(txn.Ops, opSegments, opLeases, base)
+    return goffkv.TxnResponse{Succeeded: true, Results: result}, err
+}
+
+// Runs the reads and then the writes of ops; failures are reported at base plus the operation's
+// index. Requires the store to be locked.
+func (c *memClient) run(ops []goffkv.Operation, opSegments [][]string, opLeases []*memLease, base int) ([]goffkv.TxnResult, error) {
+    result := make([]goffkv.TxnResult, len(ops))
+    writes := false
+    for i, op := range ops {
+        result[i].What = op.What
+        path := c.assemblePath(opSegments[i])
+        n, ok := c.s.nodes[path]
+        switch op.What {
+        case goffkv.Get, goffkv.Children:
+            if !ok {
+                return nil, goffkv.TxnFailure{
+                    TxnError: goffkv.TxnError{OpIndex: base + i},
+                    Reason: goffkv.OpErrNoEntry,
+                    Key: op.Key,
+                }
+            }
+        case goffkv.Exists:
+        default:
+            writes = true
+            continue
+        }
+        if !ok {
+            continue
+        }
+        result[i].Ver = n.ver
+        switch op.What {
+        case goffkv.Get:
+            result[i].Value = append([]byte(nil), n.value...)
+        case goffkv.Children:
+            result[i].Children = []string{}
+            for child := range c.s.children[path] {
+                result[i].Children = append(result[i].Children, c.unwrapPath(child))
+            }
+        }
+    }
+
+    if !writes {
+        return result, nil
+    }
+    ch := c.s.begin()
+    for i, op := range ops {
+        path := c.assemblePath(opSegments[i])
+        var err error
+        switch op.What {
+        case goffkv.Create:
+            err = ch.create(c, opSegments[i], op.Value, opLeases[i])
+        case goffkv.Set:
+            err = ch.set(path, op.Value)
+        case goffkv.Erase:
+            err = ch.erase(path)
+        }
+        if err != nil {
+            ch.rollback()
+            reason, ok := err.(goffkv.OpError)
+            if !ok {
+                return nil, err
+            }
+            return nil, goffkv.TxnFailure{
+                TxnError: goffkv.TxnError{OpIndex: base + i},
+                Reason: reason,
+                Key: op.Key,
+            }
+        }
+        if op.What == goffkv.Create || op.What == goffkv.Set {
+            result[i].Ver = c.s.rev
+        }
+    }
+    if err := ch.commit(); err != nil {
+        return nil, err
+    }
+    return result, nil
+}
+
+func (c *memClient) Close() {
+    if c.close() && c.onClose != nil {
+        c.onClose()
+    }
+}
+
+// Returns false if the client has been closed already.
+func (c *memClient) close() bool {
+    c.s.mu.Lock()
+    defer c.s.mu.Unlock()
+
+    if c.closed {
+        return false
+    }
+    c.closed = true
+
+    c.s.revoke(c.session)
+
+    c.s.dropWatches(c.s.dataWatches, c)
+    c.s.dropWatches(c.s.childWatches, c)
+    for tw := range c.s.treeWatches {
+        if tw.owner == c {
+            tw.enqueue(goffkv.WatchEvent{Kind: goffkv.EventSessionLost, Key: c.unwrapPath(tw.root)})
+            tw.lost = true
+            delete(c.s.treeWatches, tw)
+        }
+    }
+    return true
+}
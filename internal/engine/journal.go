@@ -0,0 +1,117 @@
+package engine
+
+import (
+    "sort"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// Makes a Store durable. Append is called with the store locked, before a change becomes visible;
+// if it fails, the change is rolled back and the error returned to the client.
+type Journal interface {
+    Append(rec Record) error
+}
+
+// One change of a Store, or a whole Store as returned by Snapshot.
+type Record struct {
+    Rev goffkv.Version `json:"rev"`
+    Muts []Mutation `json:"muts"`
+}
+
+// Creates or updates the node at Path, erases it if Erase is set, or, if Sequence is set, sets the
+// next number of CreateSequential (see change.setSequence).
+type Mutation struct {
+    Path string `json:"path"`
+    Erase bool `json:"erase,omitempty"`
+    Value []byte `json:"value,omitempty"`
+    Ver goffkv.Version `json:"ver,omitempty"`
+    Created goffkv.Version `json:"created,omitempty"`
+    Leased bool `json:"leased,omitempty"`
+    Sequence string `json:"seq,omitempty"`
+    Next uint64 `json:"next,omitempty"`
+}
+
+// Must be called before the store is shared.
+func (s *Store) SetJournal(j Journal) {
+    s.journal = j
+}
+
+// Returns a record recreating the store, without its leased keys. Must be called with the store
+// locked, that is, from Journal.Append, or before the store is shared.
+func (s *Store) Snapshot() Record {
+    paths := []string{}
+    for path, n := range s.nodes {
+        if n.lease == nil {
+            paths = append(paths, path)
+        }
+    }
+    // Parents sort before their children.
+    sort.Strings(paths)
+
+    rec := Record{Rev: s.rev, Muts: []Mutation{}}
+    for _, path := range paths {
+        n := s.nodes[path]
+        rec.Muts = append(rec.Muts, Mutation{Path: path, Value: n.value, Ver: n.ver, Created: n.created})
+        for name, next := range n.sequences {
+            rec.Muts = append(rec.Muts, Mutation{Path: path, Sequence: name, Next: next})
+        }
+    }
+    for name, next := range s.sequences {
+        rec.Muts = append(rec.Muts, Mutation{Sequence: name, Next: next})
+    }
+    return rec
+}
+
+// Applies a record, as passed to Journal.Append or returned by Snapshot. Must be called before the
+// store is shared; DropLeased has to be called once all the records are.
+func (s *Store) Load(rec Record) {
+    for _, m := range rec.Muts {
+        switch {
+        case m.Sequence != "":
+            sequences := s.sequences
+            if m.Path != "" {
+                n, ok := s.nodes[m.Path]
+                if !ok {
+                    continue
+                }
+                if n.sequences == nil {
+                    n.sequences = make(map[string]uint64)
+                }
+                sequences = n.sequences
+            }
+            sequences[m.Sequence] = m.Next
+        case m.Erase:
+            delete(s.nodes, m.Path)
+            delete(s.children, m.Path)
+            delete(s.children[parentOf(m.Path)], m.Path)
+        default:
+            n, ok := s.nodes[m.Path]
+            if !ok {
+                n = &node{}
+                s.nodes[m.Path] = n
+                parent := parentOf(m.Path)
+                if s.children[parent] == nil {
+                    s.children[parent] = make(map[string]struct{})
+                }
+                s.children[parent][m.Path] = struct{}{}
+            }
+            n.value, n.ver, n.created = m.Value, m.Ver, m.Created
+            n.lease = nil
+            if m.Leased {
+                n.lease = &memLease{s: s, done: make(chan struct{}), gone: true}
+            }
+        }
+    }
+    if rec.Rev > s.rev {
+        s.rev = rec.Rev
+    }
+}
+
+// Drops the leased keys, whose sessions did not survive the restart.
+func (s *Store) DropLeased() {
+    for path, n := range s.nodes {
+        if n.lease != nil {
+            delete(s.nodes, path)
+            delete(s.children[parentOf(path)], path)
+        }
+    }
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+    "errors"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+var (
+    errLeaseGone = goffkv.ErrSessionExpired.Wrap(errors.New("lease has expired or been revoked"))
+    errForeignLease = errors.New("lease was not granted by this store")
+    errInvalidTTL = errors.New("invalid lease TTL")
+)
+
+// Client sessions are leases without a TTL, revoked on Close.
+type memLease struct {
+    s *Store
+    ttl time.Duration
+    timer *time.Timer
+    done chan struct{}
+    gone bool
+}
+
+func newLease(s *Store, ttl time.Duration) *memLease {
+    l := &memLease{
+        s: s,
+        ttl: ttl,
+        done: make(chan struct{}),
+    }
+    if ttl > 0 {
+        l.timer = time.AfterFunc(ttl, func() {
+            s.mu.Lock()
+            defer s.mu.Unlock()
+            s.revoke(l)
+        })
+    }
+    return l
+}
+
+// Must be called with s.mu held.
+func (s *Store) revoke(l *memLease) {
+    if l.gone {
+        return
+    }
+    l.gone = true
+    if l.timer != nil {
+        l.timer.Stop()
+    }
+
+    ch := s.begin()
+    for path, n := range s.nodes {
+        if n.lease == l {
+            _ = ch.erase(path)
+        }
+    }
+    if len(ch.touched) == 0 {
+        ch.rollback()
+    } else {
+        // Leased keys are dropped on reload anyway, so they go even if the journal fails.
+        _ = ch.record()
+        ch.apply()
+    }
+    close(l.done)
+}
+
+func (l *memLease) TTL() time.Duration {
+    return l.ttl
+}
+
+func (l *memLease) KeepAlive() error {
+    l.s.mu.Lock()
+    defer l.s.mu.Unlock()
+
+    if l.gone {
+        return errLeaseGone
+    }
+    if l.timer != nil {
+        l.timer.Reset(l.ttl)
+    }
+    return nil
+}
+
+func (l *memLease) Revoke() error {
+    l.s.mu.Lock()
+    defer l.s.mu.Unlock()
+
+    if l.gone {
+        return errLeaseGone
+    }
+    l.s.revoke(l)
+    return nil
+}
+
+func (l *memLease) Done() <-chan struct{} {
+    return l.done
+}
+
+func (c *memClient) leaseOf(owner goffkv.Lease, lease bool) (*memLease, error) {
+    if owner != nil {
+        l, ok := owner.(*memLease)
+        if !ok || l.s != c.s {
+            return nil, errForeignLease
+        }
+        return l, nil
+    }
+    if lease {
+        return c.session, nil
+    }
+    return nil, nil
+}
+
+func (c *memClient) Grant(ttl time.Duration) (goffkv.Lease, error) {
+    // Leases without a TTL are sessions.
+    if ttl <= 0 {
+        return nil, errInvalidTTL
+    }
+    if err := c.lock(); err != nil {
+        return nil, err
+    }
+    defer c.unlock()
+
+    return newLease(c.s, ttl), nil
+}
+
+func (c *memClient) CreateWithLease(key string, value []byte, lease goffkv.Lease) (goffkv.Version, error) {
+    l, err := c.leaseOf(lease, false)
+    if err != nil {
+        return 0, err
+    }
+    if l == nil {
+        return 0, errForeignLease
+    }
+    return c.create(key, value, l)
+}
@@ -0,0 +1,43 @@
+package engine
+
+import (
+    goffkv "github.com/offscale/goffkv"
+)
+
+func (c *memClient) stat(key string, watch bool) (goffkv.Stat, []byte, goffkv.Watch, error) {
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return goffkv.Stat{}, nil, nil, err
+    }
+    if err := c.lock(); err != nil {
+        return goffkv.Stat{}, nil, nil, err
+    }
+    defer c.unlock()
+
+    path := c.assemblePath(segments)
+    n, ok := c.s.nodes[path]
+    if !ok {
+        return goffkv.Stat{}, nil, nil, goffkv.OpErrNoEntry
+    }
+    var resultWatch goffkv.Watch
+    if watch {
+        resultWatch = watchOf(c.s.addWatch(c.s.dataWatches, path, c))
+    }
+    return goffkv.Stat{
+        Version: n.ver,
+        Created: n.created,
+        Modified: n.ver,
+        NumChildren: len(c.s.children[path]),
+        DataLength: len(n.value),
+        Leased: n.lease != nil,
+    }, append([]byte(nil), n.value...), resultWatch, nil
+}
+
+func (c *memClient) StatOf(key string, watch bool) (goffkv.Stat, goffkv.Watch, error) {
+    stat, _, w, err := c.stat(key, watch)
+    return stat, w, err
+}
+
+func (c *memClient) GetWithStat(key string, watch bool) (goffkv.Stat, []byte, goffkv.Watch, error) {
+    return c.stat(key, watch)
+}
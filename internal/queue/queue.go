@@ -0,0 +1,138 @@
+// Package queue implements the queue of leased, sequentially numbered entries that the lock and
+// election packages are built on: contenders append an entry under a path, and wait for the entry
+// just before theirs to disappear until theirs is the first one.
+package queue
+
+import (
+    "context"
+    "errors"
+    "sort"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// The entry disappeared while waiting in the queue, e.g. the session expired.
+var ErrGone = errors.New("queue: entry gone")
+
+type Queue struct {
+    client goffkv.Client
+    path string
+    prefix string
+}
+
+// Returns the queue of the entries named prefix followed by their number under path.
+func New(client goffkv.Client, path string, prefix string) *Queue {
+    return &Queue{
+        client: client,
+        path: path,
+        prefix: path + "/" + prefix,
+    }
+}
+
+// Creates the queue's path if it is missing.
+func (q *Queue) Prepare(ctx context.Context) error {
+    if _, err := goffkv.DisassembleKey(q.path); err != nil {
+        return err
+    }
+    _, err := goffkv.WithContext(q.client).CasCtx(ctx, q.path, nil, 0)
+    return err
+}
+
+// Appends a new entry holding value to the queue.
+func (q *Queue) Enqueue(ctx context.Context, value []byte) (string, error) {
+    if err := q.Prepare(ctx); err != nil {
+        return "", err
+    }
+    key, _, err := goffkv.CreateSequential(q.client, q.prefix, value, true)
+    return key, err
+}
+
+// Returns the entries, in queue order.
+func (q *Queue) Entries(ctx context.Context) ([]string, error) {
+    children, _, err := goffkv.WithContext(q.client).ChildrenCtx(ctx, q.path, false)
+    if err != nil {
+        return nil, err
+    }
+    numbers := make(map[string]uint64)
+    entries := []string{}
+    for _, child := range children {
+        if n, ok := goffkv.ParseSequential(q.prefix, child); ok {
+            numbers[child] = n
+            entries = append(entries, child)
+        }
+    }
+    sort.Slice(entries, func(i, j int) bool {
+        return numbers[entries[i]] < numbers[entries[j]]
+    })
+    return entries, nil
+}
+
+// Blocks until key is the first entry, ctx is done, or key is gone, ErrGone being returned then.
+func (q *Queue) Wait(ctx context.Context, key string) error {
+    for {
+        entries, err := q.Entries(ctx)
+        if err != nil {
+            return err
+        }
+        i := -1
+        for j, entry := range entries {
+            if entry == key {
+                i = j
+            }
+        }
+        if i < 0 {
+            return ErrGone
+        }
+        if i == 0 {
+            return nil
+        }
+
+        if err := q.waitGone(ctx, entries[i - 1]); err != nil {
+            return err
+        }
+    }
+}
+
+// Blocks until key has changed or is gone, or ctx is done. On backends implementing
+// goffkv.ClientContext, the watch set is released on return rather than left until it fires.
+func (q *Queue) waitGone(ctx context.Context, key string) error {
+    wctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    ver, w, err := goffkv.WithContext(q.client).ExistsCtx(wctx, key, true)
+    if err != nil || ver == 0 {
+        return err
+    }
+    fired := make(chan struct{})
+    go func() {
+        w()
+        close(fired)
+    }()
+    select {
+    case <-fired:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Watches key until it disappears, closing lost then, or until stop is closed.
+func (q *Queue) Monitor(key string, lost chan struct{}, stop <-chan struct{}) {
+    for {
+        ver, events, err := goffkv.ExistsEvents(q.client, key)
+        if err == nil && ver != 0 {
+            select {
+            case ev := <-events:
+                if ev.Kind == goffkv.EventChanged {
+                    continue
+                }
+            case <-stop:
+                return
+            }
+        }
+        select {
+        case <-stop:
+        default:
+            close(lost)
+        }
+        return
+    }
+}
@@ -0,0 +1,83 @@
+package goffkv
+
+import (
+    "context"
+    "time"
+)
+
+const (
+    // The shortest interval KeepAlive refreshes leases at.
+    minKeepAliveInterval = time.Millisecond
+)
+
+// A group of leased keys with its own lifetime, independent of the client's session. Once the
+// lease expires or is revoked, all keys attached to it are erased.
+type Lease interface {
+    TTL() time.Duration
+    // Restarts the TTL countdown. Fails if the lease has already expired or been revoked.
+    KeepAlive() error
+    Revoke() error
+    // Closed once the lease has expired or been revoked.
+    Done() <-chan struct{}
+}
+
+// Implemented by backends that support explicit leases. Such backends also honour
+// Operation.Owner in Commit.
+type Leaser interface {
+    Grant(ttl time.Duration) (Lease, error)
+    CreateWithLease(key string, value []byte, lease Lease) (Version, error)
+}
+
+func asLeaser(c Client) (Leaser, error) {
+    l, ok := c.(Leaser)
+    if !ok {
+        return nil, UsageError{msg: "backend does not support explicit leases", arg: "Grant"}
+    }
+    return l, nil
+}
+
+// Grants a new lease that expires unless kept alive at least once per ttl.
+func Grant(c Client, ttl time.Duration) (Lease, error) {
+    l, err := asLeaser(c)
+    if err != nil {
+        return nil, err
+    }
+    if ttl <= 0 {
+        return nil, UsageError{msg: "invalid lease TTL", arg: ttl.String()}
+    }
+    return l.Grant(ttl)
+}
+
+// Same as c.Create(key, value, true), but the key is attached to lease rather than to the
+// client's session.
+func CreateWithLease(c Client, key string, value []byte, lease Lease) (Version, error) {
+    l, err := asLeaser(c)
+    if err != nil {
+        return 0, err
+    }
+    return l.CreateWithLease(key, value, lease)
+}
+
+// Keeps lease alive until ctx is done or the lease is gone, refreshing it three times per TTL.
+// Returns nil if ctx is done, and the error from KeepAlive otherwise. Leases with a TTL under 3ms
+// can not be kept alive so, and are refused with UsageError.
+func KeepAlive(ctx context.Context, lease Lease) error {
+    interval := lease.TTL() / 3
+    if interval < minKeepAliveInterval {
+        return UsageError{msg: "lease TTL too short to keep alive", arg: lease.TTL().String()}
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            if err := lease.KeepAlive(); err != nil {
+                return err
+            }
+        case <-lease.Done():
+            return lease.KeepAlive()
+        case <-ctx.Done():
+            return nil
+        }
+    }
+}
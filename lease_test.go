@@ -0,0 +1,143 @@
+package goffkv_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+    "context"
+    "errors"
+    "time"
+)
+
+func expectGone(t *testing.T, client goffkv.Client, keys ...string) {
+    for _, key := range keys {
+        ver, _, err := client.Exists(key, false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if ver != 0 {
+            t.Fatalf("expected no version (0) of %q, found %v", key, ver)
+        }
+    }
+}
+
+func TestLeaseExpiry(t *testing.T) {
+    client, err := goffkv.Open("mem://lease-expiry", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    value := []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs")
+    ttl := 100 * time.Millisecond
+
+    lease, err := goffkv.Grant(client, ttl)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = goffkv.CreateWithLease(client, "/worker", value, lease)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = client.Commit(goffkv.Txn{
+        Ops: []goffkv.Operation{
+            goffkv.Operation{
+                What: goffkv.Create,
+                Key: "/worker2",
+                Value: value,
+                Owner: lease,
+            },
+        },
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3 * ttl)
+    err = goffkv.KeepAlive(ctx, lease)
+    cancel()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ver, _, err := client.Exists("/worker2", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver == 0 {
+        t.Fatalf("expected non-zero version")
+    }
+
+    select {
+    case <-lease.Done():
+    case <-time.After(2 * ttl):
+        t.Fatalf("lease did not expire")
+    }
+    expectGone(t, client, "/worker", "/worker2")
+
+    if lease.KeepAlive() == nil {
+        t.Fatalf("expected error keeping expired lease alive")
+    }
+}
+
+func TestLeaseRevoke(t *testing.T) {
+    client, err := goffkv.Open("mem://lease-revoke", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    lease, err := goffkv.Grant(client, time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = goffkv.CreateWithLease(client, "/worker", []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs"), lease)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    err = lease.Revoke()
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectGone(t, client, "/worker")
+
+    _, err = goffkv.Grant(plainClient{client}, time.Minute)
+    _, ok := err.(goffkv.UsageError)
+    if !ok {
+        t.Fatalf("expected goffkv.UsageError error, found %v", err)
+    }
+
+    // Granted directly, bypassing the checks of goffkv.Grant.
+    if _, err := client.(goffkv.Leaser).Grant(0); err == nil {
+        t.Fatalf("expected a lease without TTL to be refused")
+    }
+}
+
+// Reports a TTL too short to refresh the lease in time.
+type tinyLease struct {
+    goffkv.Lease
+}
+
+func (tinyLease) TTL() time.Duration {
+    return 2
+}
+
+func TestKeepAliveTinyTTL(t *testing.T) {
+    client, err := goffkv.Open("mem://lease-tiny", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    lease, err := goffkv.Grant(client, time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var usageErr goffkv.UsageError
+    if err := goffkv.KeepAlive(context.Background(), tinyLease{lease}); !errors.As(err, &usageErr) {
+        t.Fatalf("expected goffkv.UsageError, found %v", err)
+    }
+}
@@ -0,0 +1,160 @@
+// Package lock implements a fair distributed mutex on top of goffkv.Client.
+//
+// Every contender appends a leased, sequentially numbered entry under the lock path and waits for
+// the entry just before its own to disappear; the owner of the first entry holds the lock.
+package lock
+
+import (
+    "context"
+    "errors"
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+    "github.com/offscale/goffkv/internal/queue"
+)
+
+const (
+    entryPrefix = "lock-"
+)
+
+var (
+    // The lock entry disappeared while waiting for or holding the lock, e.g. the session expired.
+    ErrLost = errors.New("lock: lock lost")
+    ErrNotLocked = errors.New("lock: not locked")
+    ErrLocked = errors.New("lock: already locked or being locked")
+)
+
+// A Mutex must not be locked by several goroutines at once; use one Mutex per contender.
+type Mutex struct {
+    client goffkv.Client
+    queue *queue.Queue
+
+    mu sync.Mutex
+    busy bool
+    key string
+    lost chan struct{}
+    unlocked chan struct{}
+}
+
+func NewMutex(client goffkv.Client, path string) *Mutex {
+    return &Mutex{
+        client: client,
+        queue: queue.New(client, path, entryPrefix),
+    }
+}
+
+func (m *Mutex) begin() error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if m.busy {
+        return ErrLocked
+    }
+    m.busy = true
+    return nil
+}
+
+func (m *Mutex) abort(key string) {
+    if key != "" {
+        _ = m.client.Erase(key, 0)
+    }
+    m.mu.Lock()
+    m.busy = false
+    m.mu.Unlock()
+}
+
+func (m *Mutex) acquired(key string) {
+    m.mu.Lock()
+    m.key = key
+    m.lost = make(chan struct{})
+    m.unlocked = make(chan struct{})
+    lost, unlocked := m.lost, m.unlocked
+    m.mu.Unlock()
+
+    go m.queue.Monitor(key, lost, unlocked)
+}
+
+// Blocks until the lock is acquired, ctx is done or the entry is lost.
+func (m *Mutex) Lock(ctx context.Context) error {
+    if err := m.begin(); err != nil {
+        return err
+    }
+    key, err := m.queue.Enqueue(ctx, nil)
+    if err != nil {
+        m.abort("")
+        return err
+    }
+    err = m.queue.Wait(ctx, key)
+    if err == queue.ErrGone {
+        m.abort("")
+        return ErrLost
+    }
+    if err != nil {
+        m.abort(key)
+        return err
+    }
+    m.acquired(key)
+    return nil
+}
+
+// Acquires the lock if nobody holds or waits for it, without blocking.
+func (m *Mutex) TryLock() (bool, error) {
+    if err := m.begin(); err != nil {
+        return false, err
+    }
+    ctx := context.Background()
+    key, err := m.queue.Enqueue(ctx, nil)
+    if err != nil {
+        m.abort("")
+        return false, err
+    }
+    entries, err := m.queue.Entries(ctx)
+    if err != nil {
+        m.abort(key)
+        return false, err
+    }
+    if len(entries) == 0 || entries[0] != key {
+        m.abort(key)
+        return false, nil
+    }
+    m.acquired(key)
+    return true, nil
+}
+
+func (m *Mutex) Unlock() error {
+    m.mu.Lock()
+    key, unlocked := m.key, m.unlocked
+    if key == "" {
+        m.mu.Unlock()
+        return ErrNotLocked
+    }
+    m.busy = false
+    m.key = ""
+    close(unlocked)
+    m.mu.Unlock()
+
+    err := m.client.Erase(key, 0)
+    if errors.Is(err, goffkv.OpErrNoEntry) {
+        return ErrLost
+    }
+    return err
+}
+
+// Closed once the held lock is lost, e.g. because the client's session expired. Holders should
+// stop relying on the lock as soon as it is closed. Returns nil if the lock is not held.
+func (m *Mutex) Lost() <-chan struct{} {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if m.key == "" {
+        return nil
+    }
+    return m.lost
+}
+
+// The key of the holder's entry, or "" if the lock is not held.
+func (m *Mutex) Key() string {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    return m.key
+}
@@ -0,0 +1,126 @@
+package lock_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    "github.com/offscale/goffkv/lock"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+    "context"
+    "time"
+)
+
+// Hides optional interfaces of the wrapped client, so that the generic fallbacks get tested.
+type plainClient struct {
+    goffkv.Client
+}
+
+func open(t *testing.T, plain bool) goffkv.Client {
+    client, err := goffkv.Open("mem://lock", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if plain {
+        return plainClient{client}
+    }
+    return client
+}
+
+// Runs test on native clients and on clients hiding their optional interfaces.
+func runBoth(t *testing.T, test func(t *testing.T, plain bool)) {
+    t.Run("native", func(t *testing.T) {
+        test(t, false)
+    })
+    t.Run("fallback", func(t *testing.T) {
+        test(t, true)
+    })
+}
+
+func TestMutex(t *testing.T) {
+    runBoth(t, testMutex)
+}
+
+func testMutex(t *testing.T, plain bool) {
+    client1 := open(t, plain)
+    defer client1.Close()
+    client2 := open(t, plain)
+    defer client2.Close()
+
+    m1 := lock.NewMutex(client1, "/lock")
+    m2 := lock.NewMutex(client2, "/lock")
+
+    ctx := context.Background()
+    if err := m1.Lock(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    ok, err := m2.TryLock()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ok {
+        t.Fatalf("TryLock succeeded while the lock is held")
+    }
+
+    timeoutCtx, cancel := context.WithTimeout(ctx, 100 * time.Millisecond)
+    err = m2.Lock(timeoutCtx)
+    cancel()
+    if err != context.DeadlineExceeded {
+        t.Fatalf("expected context.DeadlineExceeded error, found %v", err)
+    }
+
+    locked := make(chan error, 1)
+    go func() {
+        locked <- m2.Lock(ctx)
+    }()
+
+    select {
+    case err := <-locked:
+        t.Fatalf("Lock returned %v while the lock is held", err)
+    case <-time.After(100 * time.Millisecond):
+    }
+
+    if err := m1.Unlock(); err != nil {
+        t.Fatal(err)
+    }
+
+    select {
+    case err := <-locked:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("Lock did not return after Unlock")
+    }
+
+    if err := m2.Unlock(); err != nil {
+        t.Fatal(err)
+    }
+    if err := m2.Unlock(); err != lock.ErrNotLocked {
+        t.Fatalf("expected lock.ErrNotLocked error, found %v", err)
+    }
+}
+
+func TestMutexLost(t *testing.T) {
+    runBoth(t, testMutexLost)
+}
+
+func testMutexLost(t *testing.T, plain bool) {
+    client := open(t, plain)
+
+    m := lock.NewMutex(client, "/lock-lost")
+    ok, err := m.TryLock()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !ok {
+        t.Fatalf("TryLock failed on a free lock")
+    }
+
+    client.Close()
+
+    select {
+    case <-m.Lost():
+    case <-time.After(time.Second):
+        t.Fatalf("lock was not reported lost after Close")
+    }
+}
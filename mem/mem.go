@@ -0,0 +1,33 @@
+package goffkv_mem
+
+import (
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+    "github.com/offscale/goffkv/internal/engine"
+)
+
+var (
+    storesMu sync.Mutex
+    stores = make(map[string]*engine.Store)
+)
+
+// All clients opened with the same address share one store.
+func getStore(name string) *engine.Store {
+    storesMu.Lock()
+    defer storesMu.Unlock()
+
+    s, ok := stores[name]
+    if !ok {
+        s = engine.NewStore()
+        stores[name] = s
+    }
+    return s
+}
+
+func New(address string, prefix string) (goffkv.Client, error) {
+    return engine.NewClient(getStore(address), prefix, nil)
+}
+
+func init() {
+    goffkv.RegisterClient("mem", New)
+}
@@ -0,0 +1,71 @@
+package goffkv
+
+import (
+    "sort"
+)
+
+type Order int
+
+const (
+    Ascending Order = iota
+    Descending
+)
+
+type PageOptions struct {
+    // Only children after this one in the order are returned; "" starts from the first one.
+    After string
+    // At most this many children are returned; 0 means no limit.
+    Limit int
+    Order Order
+}
+
+// Implemented by backends that can list children page by page natively.
+type ChildrenPager interface {
+    ChildrenPage(key string, opts PageOptions) ([]string, string, error)
+}
+
+// Same as c.Children(key, false), but returns the children sorted by key, a page at a time.
+// Also returns the cursor to pass as opts.After to get the next page, or "" if this one is the last.
+//
+// Backends that do not implement ChildrenPager list all the children every time and then sort and
+// slice them.
+func ChildrenPage(c Client, key string, opts PageOptions) ([]string, string, error) {
+    if opts.Limit < 0 {
+        return nil, "", UsageError{msg: "negative limit", arg: key}
+    }
+    if cp, ok := c.(ChildrenPager); ok {
+        return cp.ChildrenPage(key, opts)
+    }
+    children, _, err := c.Children(key, false)
+    if err != nil {
+        return nil, "", err
+    }
+    page, next := pageOf(children, opts)
+    return page, next, nil
+}
+
+// Sorts keys and returns the page of them opts selects, and the cursor for the next page.
+func pageOf(keys []string, opts PageOptions) ([]string, string) {
+    sorted := append([]string{}, keys...)
+    if opts.Order == Descending {
+        sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+    } else {
+        sort.Strings(sorted)
+    }
+
+    start := 0
+    if opts.After != "" {
+        start = sort.Search(len(sorted), func(i int) bool {
+            if opts.Order == Descending {
+                return sorted[i] < opts.After
+            }
+            return sorted[i] > opts.After
+        })
+    }
+    page := sorted[start:]
+    if opts.Limit == 0 || len(page) <= opts.Limit {
+        return page, ""
+    }
+    page = page[:opts.Limit]
+    return page, page[len(page) - 1]
+}
@@ -0,0 +1,77 @@
+package goffkv_test
+
+import (
+    "fmt"
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "reflect"
+    "testing"
+)
+
+func TestChildrenPage(t *testing.T) {
+    client, err := goffkv.Open("mem://children-page", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    _ = client.Erase("/jobs", 0)
+    defer client.Erase("/jobs", 0)
+
+    _, err = client.Create("/jobs", nil, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := []string{}
+    for _, i := range []int{3, 0, 4, 1, 6, 2, 5} {
+        key := fmt.Sprintf("/jobs/%d", i)
+        if _, err := client.Create(key, nil, false); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for i := 0; i < 7; i++ {
+        expected = append(expected, fmt.Sprintf("/jobs/%d", i))
+    }
+
+    for _, order := range []goffkv.Order{goffkv.Ascending, goffkv.Descending} {
+        children := []string{}
+        opts := goffkv.PageOptions{Limit: 3, Order: order}
+        pages := 0
+        for {
+            page, next, err := goffkv.ChildrenPage(client, "/jobs", opts)
+            if err != nil {
+                t.Fatal(err)
+            }
+            children = append(children, page...)
+            pages++
+            if next == "" {
+                break
+            }
+            opts.After = next
+        }
+
+        want := expected
+        if order == goffkv.Descending {
+            want = []string{}
+            for i := len(expected) - 1; i >= 0; i-- {
+                want = append(want, expected[i])
+            }
+        }
+        if pages != 3 || !reflect.DeepEqual(children, want) {
+            t.Fatalf("expected %v in 3 pages, found %v in %v", want, children, pages)
+        }
+    }
+
+    page, next, err := goffkv.ChildrenPage(client, "/jobs", goffkv.PageOptions{After: "/jobs/1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if next != "" || !reflect.DeepEqual(page, expected[2:]) {
+        t.Fatalf("expected %v, found %v (next %q)", expected[2:], page, next)
+    }
+
+    _, _, err = goffkv.ChildrenPage(client, "/nope", goffkv.PageOptions{})
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+}
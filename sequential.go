@@ -0,0 +1,107 @@
+package goffkv
+
+import (
+    "fmt"
+    "strconv"
+)
+
+const (
+    sequenceDigits = 10
+)
+
+// Implemented by backends that can create sequential keys natively.
+type SequentialCreator interface {
+    CreateSequential(prefix string, value []byte, lease bool) (string, Version, error)
+}
+
+func sequentialKey(prefix string, n uint64) string {
+    return fmt.Sprintf("%s%0*d", prefix, sequenceDigits, n)
+}
+
+// Returns the sequence number of key if it was created by CreateSequential with prefix.
+func ParseSequential(prefix string, key string) (uint64, bool) {
+    if len(key) <= len(prefix) || key[:len(prefix)] != prefix {
+        return 0, false
+    }
+    suffix := key[len(prefix):]
+    if len(suffix) < sequenceDigits {
+        return 0, false
+    }
+    for _, c := range suffix {
+        if c < '0' || c > '9' {
+            return 0, false
+        }
+    }
+    n, err := strconv.ParseUint(suffix, 10, 64)
+    return n, err == nil
+}
+
+// Atomically creates a key named prefix followed by a zero-padded number greater than that of
+// any key created with the same prefix before, e.g. "/queue/item-0000000042" for prefix
+// "/queue/item-". Returns the key created along with its version. The parent of prefix must exist.
+//
+// Backends that do not implement SequentialCreator keep the counter in the key prefix itself,
+// which therefore must be a valid key and shows up among the parent's children.
+func CreateSequential(c Client, prefix string, value []byte, lease bool) (string, Version, error) {
+    if _, err := DisassembleKey(prefix); err != nil {
+        return "", 0, err
+    }
+    if sc, ok := c.(SequentialCreator); ok {
+        return sc.CreateSequential(prefix, value, lease)
+    }
+
+    if _, err := c.Cas(prefix, []byte("0"), 0); err != nil {
+        return "", 0, err
+    }
+    for {
+        ver, counter, _, err := c.Get(prefix, false)
+        if err != nil {
+            return "", 0, err
+        }
+        n, err := strconv.ParseUint(string(counter), 10, 64)
+        if err != nil {
+            return "", 0, UsageError{msg: "malformed sequence counter", arg: prefix}
+        }
+
+        key := sequentialKey(prefix, n)
+        result, err := c.Commit(Txn{
+            Checks: []Check{
+                Check{Key: prefix, Ver: ver},
+            },
+            Ops: []Operation{
+                Operation{
+                    What: Set,
+                    Key: prefix,
+                    Value: []byte(strconv.FormatUint(n + 1, 10)),
+                },
+                Operation{
+                    What: Create,
+                    Key: key,
+                    Value: value,
+                    Lease: lease,
+                },
+            },
+        })
+        if err == nil {
+            return key, result[1].Ver, nil
+        }
+
+        txnErr, ok := err.(TxnError)
+        if !ok {
+            return "", 0, err
+        }
+        if txnErr.OpIndex == 2 {
+            // The key is taken by someone not using CreateSequential; skip the number.
+            keyVer, _, err := c.Exists(key, false)
+            if err != nil {
+                return "", 0, err
+            }
+            if keyVer == 0 {
+                return "", 0, OpErrNoEntry
+            }
+            if _, err := c.Cas(prefix, []byte(strconv.FormatUint(n + 1, 10)), ver); err != nil {
+                return "", 0, err
+            }
+        }
+    }
+}
@@ -0,0 +1,70 @@
+package goffkv_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+)
+
+func testCreateSequential(t *testing.T, client goffkv.Client) {
+    _ = client.Erase("/queue", 0)
+    defer client.Erase("/queue", 0)
+
+    value := []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs")
+
+    _, _, err := goffkv.CreateSequential(client, "/queue/item-", value, false)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+
+    _, err = client.Create("/queue", nil, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = client.Create("/queue/item-0000000001", nil, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := []string{"/queue/item-0000000000", "/queue/item-0000000002"}
+    for i, expectedKey := range expected {
+        key, ver, err := goffkv.CreateSequential(client, "/queue/item-", value, i == 0)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if key != expectedKey {
+            t.Fatalf("expected key %q, found %q", expectedKey, key)
+        }
+        ver2, _, err := client.Exists(key, false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if ver2 != ver {
+            t.Fatalf("expected version %v, found %v", ver, ver2)
+        }
+        n, ok := goffkv.ParseSequential("/queue/item-", key)
+        if !ok || n != uint64(2 * i) {
+            t.Fatalf("expected sequence number %v, found %v (%v)", 2 * i, n, ok)
+        }
+    }
+
+    if _, ok := goffkv.ParseSequential("/queue/item-", "/queue/item-"); ok {
+        t.Fatalf("expected the prefix itself not to parse as a sequential key")
+    }
+}
+
+func TestCreateSequential(t *testing.T) {
+    client, err := goffkv.Open("mem://sequential", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        testCreateSequential(t, client)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        testCreateSequential(t, plainClient{client})
+    })
+}
@@ -0,0 +1,49 @@
+package goffkv
+
+// Metadata of a key.
+type Stat struct {
+    Version Version
+    // Backend revisions at which the key was created and last modified, or 0 if not known.
+    Created Version
+    Modified Version
+    NumChildren int
+    DataLength int
+    // Only reported by backends implementing StatReader; always false otherwise.
+    Leased bool
+}
+
+// Implemented by backends that can report key metadata natively.
+type StatReader interface {
+    StatOf(key string, watch bool)      (Stat, Watch, error)
+    GetWithStat(key string, watch bool) (Stat, []byte, Watch, error)
+}
+
+// Same as c.Exists(key, watch), but returns the key's metadata; fails with OpErrNoEntry if there
+// is no such key.
+func StatOf(c Client, key string, watch bool) (Stat, Watch, error) {
+    if sr, ok := c.(StatReader); ok {
+        return sr.StatOf(key, watch)
+    }
+    stat, _, w, err := GetWithStat(c, key, watch)
+    return stat, w, err
+}
+
+// Same as c.Get(key, watch), but also returns the key's metadata.
+func GetWithStat(c Client, key string, watch bool) (Stat, []byte, Watch, error) {
+    if sr, ok := c.(StatReader); ok {
+        return sr.GetWithStat(key, watch)
+    }
+    ver, value, w, err := c.Get(key, watch)
+    if err != nil {
+        return Stat{}, nil, nil, err
+    }
+    children, _, err := c.Children(key, false)
+    if err != nil {
+        return Stat{}, nil, nil, err
+    }
+    return Stat{
+        Version: ver,
+        NumChildren: len(children),
+        DataLength: len(value),
+    }, value, w, nil
+}
@@ -0,0 +1,76 @@
+package goffkv_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+    "bytes"
+)
+
+func testStat(t *testing.T, client goffkv.Client, native bool) {
+    _ = client.Erase("/key", 0)
+    defer client.Erase("/key", 0)
+
+    value := []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs")
+
+    _, _, err := goffkv.StatOf(client, "/key", false)
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+
+    created, err := client.Create("/key", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, child := range []string{"/key/a", "/key/b"} {
+        _, err = client.Create(child, nil, child == "/key/b")
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    ver, err := client.Set("/key", value[:10])
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    stat, value2, watch, err := goffkv.GetWithStat(client, "/key", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if watch != nil {
+        t.Fatalf("expected nil watch")
+    }
+    if !bytes.Equal(value2, value[:10]) {
+        t.Fatalf("expected value %v, found %v", value[:10], value2)
+    }
+    if stat.Version != ver || stat.NumChildren != 2 || stat.DataLength != 10 || stat.Leased {
+        t.Fatalf("unexpected stat %+v", stat)
+    }
+    if native && (stat.Created != created || stat.Modified != ver) {
+        t.Fatalf("expected revisions %v and %v, found %+v", created, ver, stat)
+    }
+
+    stat, _, err = goffkv.StatOf(client, "/key/b", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if native && !stat.Leased {
+        t.Fatalf("expected leased key, found %+v", stat)
+    }
+}
+
+func TestStat(t *testing.T) {
+    client, err := goffkv.Open("mem://stat", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        testStat(t, client, true)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        testStat(t, plainClient{client}, false)
+    })
+}
@@ -0,0 +1,44 @@
+package goffkv
+
+// Same as c.Cas(key, value, ver), but fails with OpErrVersionMismatch if the key's version is not
+// ver, or with OpErrEntryExists if ver is 0 and the key exists, rather than returning 0 and nil.
+func CasStrict(c Client, key string, value []byte, ver Version) (Version, error) {
+    resultVer, err := c.Cas(key, value, ver)
+    if err != nil || resultVer != 0 {
+        return resultVer, err
+    }
+    if ver == 0 {
+        return 0, OpErrEntryExists
+    }
+    return 0, OpErrVersionMismatch
+}
+
+// Same as c.Erase(key, ver), but fails with OpErrVersionMismatch if ver is not 0 and the key's
+// version is not ver, rather than silently doing nothing.
+func EraseStrict(c Client, key string, ver Version) error {
+    if ver == 0 {
+        return c.Erase(key, 0)
+    }
+    _, err := CommitDetailed(c, Txn{
+        Checks: []Check{
+            Check{Key: key, Ver: ver},
+        },
+        Ops: []Operation{
+            Operation{What: Erase, Key: key},
+        },
+    })
+    if f, ok := err.(TxnFailure); ok {
+        return f.Reason
+    }
+    if _, ok := err.(TxnError); !ok {
+        return err
+    }
+    curVer, _, err := c.Exists(key, false)
+    if err != nil {
+        return err
+    }
+    if curVer == 0 {
+        return OpErrNoEntry
+    }
+    return OpErrVersionMismatch
+}
@@ -0,0 +1,212 @@
+package goffkv
+
+import (
+    "context"
+    "errors"
+    "sort"
+    "sync"
+    "time"
+)
+
+const (
+    treeRescanDelay = 100 * time.Millisecond
+)
+
+// Implemented by backends that can watch whole subtrees natively.
+type TreeWatcher interface {
+    WatchTree(ctx context.Context, path string) (<-chan WatchEvent, error)
+}
+
+// Delivers a continuous, ordered stream of EventCreated, EventChanged and EventErased events for
+// path and every key under it (path "" stands for the whole namespace) until ctx is done; then
+// the channel is closed. Whenever changes might have been missed, EventResync is delivered.
+//
+// Backends that do not implement TreeWatcher are watched by re-reading the subtree each time
+// one of the one-shot watches fires, and reporting how it differs from the previous reading.
+// Changes in between may be missed, e.g. a key created and erased again, so the events of every
+// reading are preceded by EventResync. Such backends can only watch subtrees rooted at a key, not
+// the whole namespace.
+func WatchTree(ctx context.Context, c Client, path string) (<-chan WatchEvent, error) {
+    if _, err := DisassemblePath(path); err != nil {
+        return nil, err
+    }
+    if tw, ok := c.(TreeWatcher); ok {
+        return tw.WatchTree(ctx, path)
+    }
+    if path == "" {
+        return nil, UsageError{msg: "backend can not watch the whole namespace", arg: path}
+    }
+
+    ts := &treeScanner{
+        client: c,
+        root: path,
+        armed: make(map[string]bool),
+        notify: make(chan struct{}, 1),
+    }
+    snapshot, err := ts.scan()
+    if err != nil {
+        return nil, err
+    }
+
+    ch := make(chan WatchEvent)
+    go ts.run(ctx, snapshot, ch)
+    return ch, nil
+}
+
+type treeScanner struct {
+    client Client
+    root string
+    mu sync.Mutex
+    armed map[string]bool
+    notify chan struct{}
+}
+
+// Arms the watch unless the one armed earlier for the same id has not fired yet.
+func (ts *treeScanner) arm(id string, watch bool, do func(watch bool) (Watch, error)) error {
+    ts.mu.Lock()
+    armed := ts.armed[id]
+    ts.mu.Unlock()
+
+    w, err := do(watch && !armed)
+    if err != nil || w == nil {
+        return err
+    }
+
+    ts.mu.Lock()
+    ts.armed[id] = true
+    ts.mu.Unlock()
+    go func() {
+        w()
+        ts.mu.Lock()
+        delete(ts.armed, id)
+        ts.mu.Unlock()
+        select {
+        case ts.notify <- struct{}{}:
+        default:
+        }
+    }()
+    return nil
+}
+
+func (ts *treeScanner) scan() (map[string]Version, error) {
+    c := ts.client
+    snapshot := make(map[string]Version)
+
+    var rootVer Version
+    err := ts.arm("e" + ts.root, true, func(watch bool) (Watch, error) {
+        ver, w, err := c.Exists(ts.root, watch)
+        rootVer = ver
+        return w, err
+    })
+    if err != nil || rootVer == 0 {
+        return snapshot, err
+    }
+
+    queue := []string{ts.root}
+    for len(queue) != 0 {
+        key := queue[0]
+        queue = queue[1:]
+
+        err := ts.arm("d" + key, true, func(watch bool) (Watch, error) {
+            ver, _, w, err := c.Get(key, watch)
+            snapshot[key] = ver
+            return w, err
+        })
+        if err == nil {
+            err = ts.arm("c" + key, true, func(watch bool) (Watch, error) {
+                children, w, err := c.Children(key, watch)
+                queue = append(queue, children...)
+                return w, err
+            })
+        }
+        if errors.Is(err, OpErrNoEntry) {
+            // Erased while scanning; the parent's children watch has fired already.
+            delete(snapshot, key)
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    return snapshot, nil
+}
+
+func diffSnapshots(old map[string]Version, cur map[string]Version) []WatchEvent {
+    erased := []string{}
+    for key := range old {
+        if _, ok := cur[key]; !ok {
+            erased = append(erased, key)
+        }
+    }
+    sort.Sort(sort.Reverse(sort.StringSlice(erased)))
+
+    present := []string{}
+    for key := range cur {
+        present = append(present, key)
+    }
+    sort.Strings(present)
+
+    events := []WatchEvent{}
+    for _, key := range erased {
+        events = append(events, WatchEvent{Kind: EventErased, Key: key})
+    }
+    for _, key := range present {
+        oldVer, ok := old[key]
+        switch {
+        case !ok:
+            events = append(events, WatchEvent{Kind: EventCreated, Key: key, Ver: cur[key]})
+        case oldVer != cur[key]:
+            events = append(events, WatchEvent{Kind: EventChanged, Key: key, Ver: cur[key]})
+        }
+    }
+    return events
+}
+
+func (ts *treeScanner) run(ctx context.Context, snapshot map[string]Version, ch chan<- WatchEvent) {
+    defer close(ch)
+
+    send := func(ev WatchEvent) bool {
+        select {
+        case ch <- ev:
+            return true
+        case <-ctx.Done():
+            return false
+        }
+    }
+
+    for {
+        select {
+        case <-ts.notify:
+        case <-ctx.Done():
+            return
+        }
+
+        cur, err := ts.scan()
+        if err != nil {
+            if !send(WatchEvent{Kind: EventResync, Key: ts.root}) {
+                return
+            }
+            select {
+            case <-time.After(treeRescanDelay):
+            case <-ctx.Done():
+                return
+            }
+            select {
+            case ts.notify <- struct{}{}:
+            default:
+            }
+            continue
+        }
+
+        // Whatever happened since the previous scan is only known by its outcome.
+        if !send(WatchEvent{Kind: EventResync, Key: ts.root}) {
+            return
+        }
+        for _, ev := range diffSnapshots(snapshot, cur) {
+            if !send(ev) {
+                return
+            }
+        }
+        snapshot = cur
+    }
+}
@@ -0,0 +1,134 @@
+package goffkv_test
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+    "context"
+    "time"
+)
+
+// Skips the EventResync events rescans are preceded by, expecting one before the event if rescans
+// is set.
+func expectTreeEvent(t *testing.T, events <-chan goffkv.WatchEvent, rescans bool, kind goffkv.EventKind, key string) goffkv.WatchEvent {
+    resynced := false
+    for {
+        select {
+        case ev := <-events:
+            if rescans && ev.Kind == goffkv.EventResync && ev.Key == "/root" {
+                resynced = true
+                continue
+            }
+            if rescans && !resynced {
+                t.Fatalf("expected resync event before %v event on %q", ev.Kind, ev.Key)
+            }
+            if ev.Kind != kind || ev.Key != key {
+                t.Fatalf("expected %v event on %q, found %v event on %q", kind, key, ev.Kind, ev.Key)
+            }
+            return ev
+        case <-time.After(time.Second):
+            t.Fatalf("timeout reached before %v event", kind)
+        }
+    }
+}
+
+func testWatchTree(t *testing.T, client goffkv.Client, rescans bool) {
+    value := []byte("wpqznrhankjpjivpwxixcqkfmpumwyqs")
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    events, err := goffkv.WatchTree(ctx, client, "/root")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = client.Create("/other", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Erase("/other", 0)
+
+    ver, err := client.Create("/root", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ev := expectTreeEvent(t, events, rescans, goffkv.EventCreated, "/root")
+    if ev.Ver != ver {
+        t.Fatalf("expected version %v, found %v", ver, ev.Ver)
+    }
+
+    _, err = client.Create("/root/child", value, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectTreeEvent(t, events, rescans, goffkv.EventCreated, "/root/child")
+
+    ver, err = client.Set("/root/child", value)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ev = expectTreeEvent(t, events, rescans, goffkv.EventChanged, "/root/child")
+    if ev.Ver != ver {
+        t.Fatalf("expected version %v, found %v", ver, ev.Ver)
+    }
+
+    err = client.Erase("/root", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectTreeEvent(t, events, rescans, goffkv.EventErased, "/root/child")
+    // Erased in the same scan.
+    expectTreeEvent(t, events, false, goffkv.EventErased, "/root")
+
+    cancel()
+    select {
+    case ev, ok := <-events:
+        if ok {
+            t.Fatalf("expected closed channel, found %v event on %q", ev.Kind, ev.Key)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("channel was not closed after cancellation")
+    }
+}
+
+func TestWatchTree(t *testing.T) {
+    client, err := goffkv.Open("mem://tree", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        testWatchTree(t, client, false)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        testWatchTree(t, plainClient{client}, true)
+    })
+
+    t.Run("fallback_missed", func(t *testing.T) {
+        ctx, cancel := context.WithCancel(context.Background())
+        defer cancel()
+        _, err := client.Create("/root", nil, false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer client.Erase("/root", 0)
+
+        events, err := goffkv.WatchTree(ctx, plainClient{client}, "/root")
+        if err != nil {
+            t.Fatal(err)
+        }
+        _, err = client.Create("/root/a", nil, false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        err = client.Erase("/root/a", 0)
+        if err != nil {
+            t.Fatal(err)
+        }
+        // The key may be gone by the time the subtree is read again.
+        expectEvent(t, events, goffkv.EventResync, "/root")
+    })
+}
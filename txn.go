@@ -0,0 +1,400 @@
+package goffkv
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// What a Predicate asserts about its key.
+type PredicateKind int
+
+const (
+    // The key exists, at any version.
+    PredExists PredicateKind = iota + 1
+    // The key does not exist. Only backends implementing DetailedCommitter can tell that a key is
+    // missing within a transaction; on other backends transactions with such predicates fail with
+    // UsageError before anything is committed. A Create alone is enough to create a key only if it
+    // is missing.
+    PredAbsent
+    // The key exists and holds Value.
+    PredValue
+    // The key exists and has exactly NumChildren children.
+    PredNumChildren
+)
+
+// A condition on a key that a Check can not express. Client.Commit does not take predicates;
+// CommitDetailed, CommitRead, CommitCond and TxnBuilder do. The OpIndex of a TxnError counts the
+// checks of the transaction, then its predicates, then its operations.
+type Predicate struct {
+    Key string
+    Kind PredicateKind
+    Value []byte
+    NumChildren int
+}
+
+// Transaction failed on some operation, and why. Returned by CommitDetailed.
+type TxnFailure struct {
+    TxnError
+    // OpErrVersionMismatch, OpErrNoEntry, OpErrEntryExists, OpErrValueMismatch or
+    // OpErrNumChildrenMismatch for a failed check or predicate; OpErrEntryExists, OpErrNoEntry or
+    // OpErrEphem for a failed operation.
+    Reason OpError
+    // The key of the failed check, predicate or operation.
+    Key string
+    // For a failed check or predicate, the version the key actually had, or 0 if there was no such
+    // key.
+    Observed Version
+}
+
+// Implemented by backends that can tell natively why a transaction failed, and check predicates.
+type DetailedCommitter interface {
+    CommitDetailed(txn Txn, preds []Predicate) ([]TxnOpResult, error)
+}
+
+func (e TxnFailure) Error() string {
+    s := fmt.Sprintf("%s: %s", e.TxnError.Error(), e.Reason.With("", e.Key).Error())
+    if e.Observed != 0 {
+        s += fmt.Sprintf(" (observed version %d)", e.Observed)
+    }
+    return s
+}
+
+// Allows errors.Is(err, OpErrVersionMismatch) and the like.
+func (e TxnFailure) Unwrap() error {
+    return e.Reason
+}
+
+// Allows errors.As(err, &txnErr) with txnErr of type TxnError.
+func (e TxnFailure) As(target interface{}) bool {
+    if p, ok := target.(*TxnError); ok {
+        *p = e.TxnError
+        return true
+    }
+    return false
+}
+
+// Same as c.Commit(txn), but fails with TxnFailure rather than TxnError, and also checks preds.
+//
+// Backends that do not implement DetailedCommitter are asked about the failed check or operation
+// after the fact, so the reason reflects the keys as they are then, not as the transaction saw
+// them. If even that fails, the TxnError is returned as is. Predicates are checked there as
+// described for CommitRead.
+func CommitDetailed(c Client, txn Txn, preds ...Predicate) ([]TxnOpResult, error) {
+    if dc, ok := c.(DetailedCommitter); ok {
+        return dc.CommitDetailed(txn, preds)
+    }
+    if len(preds) != 0 {
+        results, err := CommitRead(c, txn, preds...)
+        if err != nil {
+            return nil, err
+        }
+        result := []TxnOpResult{}
+        for _, r := range results {
+            if r.What == Create || r.What == Set {
+                result = append(result, TxnOpResult{What: r.What, Ver: r.Ver})
+            }
+        }
+        return result, nil
+    }
+    result, err := c.Commit(txn)
+    txnErr, ok := err.(TxnError)
+    if !ok {
+        return result, err
+    }
+    if f, ok := diagnoseTxn(c, txn, txnErr); ok {
+        return nil, f
+    }
+    return nil, txnErr
+}
+
+func diagnoseTxn(c Client, txn Txn, txnErr TxnError) (TxnFailure, bool) {
+    f := TxnFailure{TxnError: txnErr}
+    i := txnErr.OpIndex
+    if i < 0 || i >= len(txn.Checks) + len(txn.Ops) {
+        return f, false
+    }
+
+    if i < len(txn.Checks) {
+        f.Key = txn.Checks[i].Key
+        ver, _, err := c.Exists(f.Key, false)
+        if err != nil {
+            return f, false
+        }
+        f.Observed = ver
+        if ver == 0 {
+            f.Reason = OpErrNoEntry
+        } else {
+            f.Reason = OpErrVersionMismatch
+        }
+        return f, true
+    }
+
+    op := txn.Ops[i - len(txn.Checks)]
+    f.Key = op.Key
+    f.Reason = OpErrNoEntry
+    if op.What != Create {
+        return f, true
+    }
+
+    ver, _, err := c.Exists(op.Key, false)
+    if err != nil {
+        return f, false
+    }
+    if ver != 0 {
+        f.Reason = OpErrEntryExists
+        return f, true
+    }
+    if parent := op.Key[:strings.LastIndexByte(op.Key, '/')]; parent != "" {
+        ver, _, err := c.Exists(parent, false)
+        if err != nil {
+            return f, false
+        }
+        if ver != 0 {
+            f.Reason = OpErrEphem
+        }
+    }
+    return f, true
+}
+
+// Result of one operation of a transaction committed with CommitRead.
+type TxnResult struct {
+    What Action
+    // The new version for Create and Set; the version read for Get, Exists (0 if there is no
+    // such key) and Children; 0 for Erase.
+    Ver Version
+    // Only set for Get.
+    Value []byte
+    // Only set for Children.
+    Children []string
+}
+
+// Implemented by backends that can read inside transactions natively.
+type ReadCommitter interface {
+    CommitRead(txn Txn, preds []Predicate) ([]TxnResult, error)
+}
+
+func isRead(what Action) bool {
+    return what == Get || what == Exists || what == Children
+}
+
+// Same as CommitDetailed(c, txn, preds...), but also accepts the Get, Exists and Children actions
+// and returns a result for every operation. The reads see the keys as they are once the checks
+// have passed and before any of the transaction's writes are applied; Get and Children of a missing
+// key fail the transaction with OpErrNoEntry. So a transaction of reads only is a consistent
+// snapshot of several keys.
+//
+// Backends that do not implement ReadCommitter read the keys first and then commit the writes with
+// extra checks that the keys read have not changed meanwhile, starting over if they have. Keys
+// found missing and children added meanwhile are not noticed there. Predicates are checked the same
+// way, except PredAbsent, which those backends can not check.
+func CommitRead(c Client, txn Txn, preds ...Predicate) ([]TxnResult, error) {
+    if rc, ok := c.(ReadCommitter); ok {
+        return rc.CommitRead(txn, preds)
+    }
+    for _, pred := range preds {
+        if pred.Kind == PredAbsent {
+            return nil, UsageError{msg: "backend can not check that a key is absent", arg: pred.Key}
+        }
+    }
+    for {
+        result, retry, err := commitReadOnce(c, txn, preds)
+        if !retry {
+            return result, err
+        }
+    }
+}
+
+const (
+    // The origin of the checks guarding a read.
+    noOrigin = -1
+)
+
+// Returns the version of key and its children, or OpErrNoEntry.
+func readChildren(c Client, key string) (Version, []string, error) {
+    ver, _, err := c.Exists(key, false)
+    if err == nil && ver == 0 {
+        err = OpErrNoEntry
+    }
+    if err != nil {
+        return 0, nil, err
+    }
+    children, _, err := c.Children(key, false)
+    return ver, children, err
+}
+
+// Lowers txn and preds to a transaction of version checks and writes only and commits it. Every
+// check and operation committed is mapped back to the index it originates from.
+func commitReadOnce(c Client, txn Txn, preds []Predicate) ([]TxnResult, bool, error) {
+    checks := []Check{}
+    checkOrigin := []int{}
+    ops := []Operation{}
+    opOrigin := []int{}
+    failed := make(map[int]TxnFailure)
+
+    guard := func(origin int, key string, ver Version) {
+        checks = append(checks, Check{Key: key, Ver: ver})
+        checkOrigin = append(checkOrigin, origin)
+    }
+    fail := func(i int, reason OpError, key string, observed Version) {
+        failed[i] = TxnFailure{
+            TxnError: TxnError{OpIndex: i},
+            Reason: reason,
+            Key: key,
+            Observed: observed,
+        }
+    }
+
+    for i, check := range txn.Checks {
+        guard(i, check.Key, check.Ver)
+    }
+    for j, pred := range preds {
+        i := len(txn.Checks) + j
+        switch pred.Kind {
+        case PredExists:
+            guard(i, pred.Key, 0)
+        case PredValue:
+            ver, value, _, err := c.Get(pred.Key, false)
+            switch {
+            case errors.Is(err, OpErrNoEntry):
+                fail(i, OpErrNoEntry, pred.Key, 0)
+            case err != nil:
+                return nil, false, err
+            case !bytes.Equal(value, pred.Value):
+                fail(i, OpErrValueMismatch, pred.Key, ver)
+            default:
+                guard(i, pred.Key, ver)
+            }
+        case PredNumChildren:
+            ver, children, err := readChildren(c, pred.Key)
+            switch {
+            case errors.Is(err, OpErrNoEntry):
+                fail(i, OpErrNoEntry, pred.Key, 0)
+            case err != nil:
+                return nil, false, err
+            case len(children) != pred.NumChildren:
+                fail(i, OpErrNumChildrenMismatch, pred.Key, ver)
+            default:
+                guard(i, pred.Key, ver)
+                for _, child := range children {
+                    guard(noOrigin, child, 0)
+                }
+            }
+        default:
+            return nil, false, UsageError{msg: "invalid predicate kind", arg: pred.Key}
+        }
+    }
+
+    base := len(txn.Checks) + len(preds)
+    result := make([]TxnResult, len(txn.Ops))
+    for j, op := range txn.Ops {
+        i := base + j
+        result[j].What = op.What
+        if !isRead(op.What) {
+            ops = append(ops, op)
+            opOrigin = append(opOrigin, i)
+            continue
+        }
+
+        var ver Version
+        var err error
+        switch op.What {
+        case Get:
+            ver, result[j].Value, _, err = c.Get(op.Key, false)
+        case Exists:
+            ver, _, err = c.Exists(op.Key, false)
+        case Children:
+            ver, result[j].Children, err = readChildren(c, op.Key)
+            for _, child := range result[j].Children {
+                guard(noOrigin, child, 0)
+            }
+        }
+        if errors.Is(err, OpErrNoEntry) {
+            fail(i, OpErrNoEntry, op.Key, 0)
+            continue
+        }
+        if err != nil {
+            return nil, false, err
+        }
+        result[j].Ver = ver
+        if ver != 0 {
+            guard(noOrigin, op.Key, ver)
+        }
+    }
+
+    // If something is known to fail, only the checks preceding it are committed, to see whether
+    // they fail first.
+    first := base + len(txn.Ops)
+    for i := range failed {
+        if i < first {
+            first = i
+        }
+    }
+    stop := first
+    if len(failed) != 0 && stop > base {
+        stop = base
+    }
+    committed := Txn{}
+    origins := []int{}
+    for k, check := range checks {
+        if checkOrigin[k] < stop {
+            committed.Checks = append(committed.Checks, check)
+            origins = append(origins, checkOrigin[k])
+        }
+    }
+    for k, op := range ops {
+        if opOrigin[k] < stop {
+            committed.Ops = append(committed.Ops, op)
+            origins = append(origins, opOrigin[k])
+        }
+    }
+
+    opResults, err := CommitDetailed(c, committed)
+    if err != nil {
+        return commitReadFailed(txn, preds, err, origins)
+    }
+    if f, ok := failed[first]; ok {
+        return nil, false, f
+    }
+
+    k := 0
+    for n, op := range committed.Ops {
+        if op.What != Create && op.What != Set {
+            continue
+        }
+        if i := origins[len(committed.Checks) + n]; i >= base {
+            result[i - base].Ver = opResults[k].Ver
+        }
+        k++
+    }
+    return result, false, nil
+}
+
+// Maps the failure of the lowered transaction back to txn and preds, or tells to start over.
+func commitReadFailed(txn Txn, preds []Predicate, err error, origins []int) ([]TxnResult, bool, error) {
+    f, detailed := err.(TxnFailure)
+    if !detailed {
+        txnErr, ok := err.(TxnError)
+        if !ok {
+            return nil, false, err
+        }
+        f = TxnFailure{TxnError: txnErr}
+    }
+    origin := origins[f.OpIndex]
+    f.OpIndex = origin
+
+    switch {
+    case origin == noOrigin:
+        return nil, true, nil
+    case origin < len(txn.Checks) || origin >= len(txn.Checks) + len(preds) ||
+        preds[origin - len(txn.Checks)].Kind == PredExists:
+        if !detailed {
+            return nil, false, f.TxnError
+        }
+        return nil, false, f
+    default:
+        // The value or children changed since they were read.
+        return nil, true, nil
+    }
+}
@@ -0,0 +1,123 @@
+package goffkv_test
+
+import (
+    "bytes"
+    "errors"
+    goffkv "github.com/offscale/goffkv"
+    "github.com/offscale/goffkv/goffkvtest"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+)
+
+func TestCommitDetailed(t *testing.T) {
+    client, err := goffkv.Open("mem://txn-detailed", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        goffkvtest.TxnFailureDetailed(t, client)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        goffkvtest.TxnFailureDetailed(t, plainClient{client})
+    })
+}
+
+func TestTxnFailureErrors(t *testing.T) {
+    var err error = goffkv.TxnFailure{
+        TxnError: goffkv.TxnError{OpIndex: 1},
+        Reason: goffkv.OpErrVersionMismatch,
+        Key: "/foo",
+        Observed: 5,
+    }
+
+    expected := `transaction failed on operation with index 1: "/foo": version mismatch (observed version 5)`
+    if err.Error() != expected {
+        t.Fatalf("expected %q, found %q", expected, err.Error())
+    }
+    if !errors.Is(err, goffkv.OpErrVersionMismatch) {
+        t.Fatalf("expected %v to match goffkv.OpErrVersionMismatch", err)
+    }
+    var txnErr goffkv.TxnError
+    if !errors.As(err, &txnErr) || txnErr.OpIndex != 1 {
+        t.Fatalf("expected %v to match goffkv.TxnError with OpIndex 1", err)
+    }
+}
+
+func TestCommitRead(t *testing.T) {
+    client, err := goffkv.Open("mem://txn-read", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        goffkvtest.TxnRead(t, client)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        goffkvtest.TxnRead(t, plainClient{client})
+    })
+}
+
+// Changes the key right after it is first read.
+type racyClient struct {
+    goffkv.Client
+    raced bool
+}
+
+func (c *racyClient) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    ver, value, w, err := c.Client.Get(key, watch)
+    if !c.raced {
+        c.raced = true
+        _, _ = c.Client.Set(key, []byte("raced"))
+    }
+    return ver, value, w, err
+}
+
+func TestCommitReadRetry(t *testing.T) {
+    client, err := goffkv.Open("mem://txn-read-retry", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    _ = client.Erase("/key", 0)
+    defer client.Erase("/key", 0)
+
+    _, err = client.Create("/key", []byte("original"), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    racy := &racyClient{Client: plainClient{client}}
+    result, err := goffkv.CommitRead(racy, goffkv.Txn{
+        Ops: []goffkv.Operation{
+            goffkv.Operation{What: goffkv.Get, Key: "/key"},
+        },
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !racy.raced || !bytes.Equal(result[0].Value, []byte("raced")) {
+        t.Fatalf("expected the read to be retried, found %q", result[0].Value)
+    }
+}
+
+func TestPredicates(t *testing.T) {
+    client, err := goffkv.Open("mem://txn-predicates", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        goffkvtest.TxnPredicates(t, client)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        goffkvtest.TxnPredicates(t, plainClient{client})
+    })
+}
@@ -0,0 +1,159 @@
+package goffkv
+
+import (
+    "context"
+    "errors"
+    "math/rand"
+    "time"
+)
+
+const (
+    updateBackoffMin = 10 * time.Millisecond
+    updateBackoffMax = time.Second
+)
+
+// Waits for a random duration of up to the current backoff, then doubles it.
+func backoff(ctx context.Context, d *time.Duration) error {
+    wait := time.Duration(rand.Int63n(int64(*d)) + 1)
+    if *d *= 2; *d > updateBackoffMax {
+        *d = updateBackoffMax
+    }
+    select {
+    case <-time.After(wait):
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Reads the key, calls fn with its value (exists is false and old nil if there is no such key)
+// and stores the value fn returns with c.Cas, creating the key if it was absent. If the key has
+// changed meanwhile, it starts over after a jittered exponential backoff, until ctx is done.
+// Returns the final version of the key; errors returned by fn are returned as is.
+func Update(ctx context.Context, c Client, key string, fn func(old []byte, exists bool) ([]byte, error)) (Version, error) {
+    cc := WithContext(c)
+    d := updateBackoffMin
+    for {
+        ver, old, _, err := cc.GetCtx(ctx, key, false)
+        exists := err == nil
+        if errors.Is(err, OpErrNoEntry) {
+            err = nil
+        }
+        if err != nil {
+            return 0, err
+        }
+
+        value, err := fn(old, exists)
+        if err != nil {
+            return 0, err
+        }
+        newVer, err := cc.CasCtx(ctx, key, value, ver)
+        if errors.Is(err, OpErrNoEntry) && ver != 0 {
+            // Erased meanwhile.
+            err = nil
+        }
+        if err != nil || newVer != 0 {
+            return newVer, err
+        }
+
+        if err := backoff(ctx, &d); err != nil {
+            return 0, err
+        }
+    }
+}
+
+// Same as Update, but for several keys at once: fn gets the values of the keys that exist and
+// returns the values to store, which are then committed in one transaction checking that none of
+// the keys has changed. Keys fn returns no value for are left as they are; keys not among keys
+// may not be returned. Returns the new versions of the keys stored.
+//
+// As the keys are read one by one, fn may be given values that were never current together; what
+// it returns then is thrown away. Keys found missing and left as they are may be created before the
+// transaction is committed on backends not implementing DetailedCommitter, which can not check that
+// a key is missing.
+func UpdateMany(ctx context.Context, c Client, keys []string, fn func(old map[string][]byte) (map[string][]byte, error)) (map[string]Version, error) {
+    seen := make(map[string]bool)
+    for _, key := range keys {
+        if _, err := DisassembleKey(key); err != nil {
+            return nil, err
+        }
+        if seen[key] {
+            return nil, UsageError{msg: "duplicate key", arg: key}
+        }
+        seen[key] = true
+    }
+
+    _, detailed := c.(DetailedCommitter)
+    cc := WithContext(c)
+    d := updateBackoffMin
+    for {
+        vers := make(map[string]Version)
+        old := make(map[string][]byte)
+        for _, key := range keys {
+            ver, value, _, err := cc.GetCtx(ctx, key, false)
+            if errors.Is(err, OpErrNoEntry) {
+                continue
+            }
+            if err != nil {
+                return nil, err
+            }
+            vers[key] = ver
+            old[key] = value
+        }
+
+        values, err := fn(old)
+        if err != nil {
+            return nil, err
+        }
+        for key := range values {
+            if !seen[key] {
+                return nil, UsageError{msg: "key not among the keys updated", arg: key}
+            }
+        }
+
+        txn := Txn{}
+        preds := []Predicate{}
+        written := []string{}
+        for _, key := range keys {
+            ver, exists := vers[key]
+            value, ok := values[key]
+            switch {
+            case exists:
+                txn.Checks = append(txn.Checks, Check{Key: key, Ver: ver})
+            case !ok && detailed:
+                preds = append(preds, Predicate{Key: key, Kind: PredAbsent})
+            }
+            // The Create of a key found missing fails by itself if it has been created since.
+            if !ok {
+                continue
+            }
+            op := Operation{What: Set, Key: key, Value: value}
+            if !exists {
+                op.What = Create
+            }
+            txn.Ops = append(txn.Ops, op)
+            written = append(written, key)
+        }
+
+        var result []TxnOpResult
+        if ctxErr := runCtx(ctx, func() { result, err = CommitDetailed(c, txn, preds...) }); ctxErr != nil {
+            return nil, ctxErr
+        }
+        var f TxnFailure
+        if errors.As(err, &f) && (f.OpIndex < len(txn.Checks) + len(preds) || f.Reason == OpErrEntryExists) {
+            if err := backoff(ctx, &d); err != nil {
+                return nil, err
+            }
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        newVers := make(map[string]Version)
+        for i, key := range written {
+            newVers[key] = result[i].Ver
+        }
+        return newVers, nil
+    }
+}
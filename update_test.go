@@ -0,0 +1,175 @@
+package goffkv_test
+
+import (
+    "context"
+    "errors"
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "strconv"
+    "sync"
+    "testing"
+)
+
+func increment(old []byte, exists bool) ([]byte, error) {
+    n := 0
+    if exists {
+        var err error
+        if n, err = strconv.Atoi(string(old)); err != nil {
+            return nil, err
+        }
+    }
+    return []byte(strconv.Itoa(n + 1)), nil
+}
+
+// Erases the key right before it is first stored.
+type erasingClient struct {
+    goffkv.Client
+    erased bool
+}
+
+func (c *erasingClient) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    if !c.erased {
+        c.erased = true
+        _ = c.Client.Erase(key, 0)
+    }
+    return c.Client.Cas(key, value, ver)
+}
+
+func TestUpdate(t *testing.T) {
+    client, err := goffkv.Open("mem://update", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    _ = client.Erase("/counter", 0)
+    defer client.Erase("/counter", 0)
+
+    ctx := context.Background()
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 10; j++ {
+                if _, err := goffkv.Update(ctx, client, "/counter", increment); err != nil {
+                    t.Error(err)
+                    return
+                }
+            }
+        }()
+    }
+    wg.Wait()
+
+    ver, value, _, err := client.Get("/counter", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(value) != "80" {
+        t.Fatalf("expected value 80, found %s", value)
+    }
+
+    ver2, err := goffkv.Update(ctx, client, "/counter", increment)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ver2 <= ver {
+        t.Fatalf("expected version greater than %v, found %v", ver, ver2)
+    }
+
+    erasing := &erasingClient{Client: plainClient{client}}
+    if _, err := goffkv.Update(ctx, erasing, "/counter", increment); err != nil {
+        t.Fatal(err)
+    }
+    if _, value, _, err := client.Get("/counter", false); err != nil || string(value) != "1" {
+        t.Fatalf("expected the counter to be created again, found %q (error %v)", value, err)
+    }
+
+    errAbort := errors.New("abort")
+    _, err = goffkv.Update(ctx, client, "/counter", func([]byte, bool) ([]byte, error) {
+        return nil, errAbort
+    })
+    if err != errAbort {
+        t.Fatalf("expected the error of fn, found %v", err)
+    }
+
+    canceled, cancel := context.WithCancel(ctx)
+    cancel()
+    _, err = goffkv.Update(canceled, client, "/counter", increment)
+    if err != context.Canceled {
+        t.Fatalf("expected context.Canceled error, found %v", err)
+    }
+}
+
+func TestUpdateMany(t *testing.T) {
+    client, err := goffkv.Open("mem://update-many", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    keys := []string{"/a", "/b"}
+    for _, key := range keys {
+        _ = client.Erase(key, 0)
+        defer client.Erase(key, 0)
+    }
+    _, err = client.Create("/a", []byte("100"), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Moves one unit from /a to /b; /b is created by the first move.
+    move := func(old map[string][]byte) (map[string][]byte, error) {
+        a, err := strconv.Atoi(string(old["/a"]))
+        if err != nil {
+            return nil, err
+        }
+        b, _ := increment(old["/b"], old["/b"] != nil)
+        return map[string][]byte{"/a": []byte(strconv.Itoa(a - 1)), "/b": b}, nil
+    }
+
+    ctx := context.Background()
+    var wg sync.WaitGroup
+    for i := 0; i < 5; i++ {
+        // Some go through the generic implementation of the checks.
+        var c goffkv.Client = client
+        if i % 2 == 1 {
+            c = plainClient{client}
+        }
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 10; j++ {
+                if _, err := goffkv.UpdateMany(ctx, c, keys, move); err != nil {
+                    t.Error(err)
+                    return
+                }
+            }
+        }()
+    }
+    wg.Wait()
+
+    vers, err := goffkv.UpdateMany(ctx, client, keys, func(old map[string][]byte) (map[string][]byte, error) {
+        if string(old["/a"]) != "50" || string(old["/b"]) != "50" {
+            t.Fatalf("expected 50 and 50, found %s and %s", old["/a"], old["/b"])
+        }
+        return map[string][]byte{"/b": []byte("0")}, nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    ver, _, err := client.Exists("/b", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(vers) != 1 || vers["/b"] != ver {
+        t.Fatalf("expected only /b at version %v, found %v", ver, vers)
+    }
+
+    _, err = goffkv.UpdateMany(ctx, client, keys, func(map[string][]byte) (map[string][]byte, error) {
+        return map[string][]byte{"/c": nil}, nil
+    })
+    if _, ok := err.(goffkv.UsageError); !ok {
+        t.Fatalf("expected goffkv.UsageError error, found %v", err)
+    }
+}
@@ -0,0 +1,135 @@
+package goffkv
+
+import (
+    "bytes"
+    "errors"
+    "sort"
+)
+
+// A key read by Walk or GetTree.
+type TreeEntry struct {
+    Key string
+    Ver Version
+    // nil with WalkOptions.KeysOnly.
+    Value []byte
+}
+
+type WalkOptions struct {
+    // Keys more than this many levels below the root are skipped; 0 means no limit.
+    MaxDepth int
+    // Values are not read.
+    KeysOnly bool
+    // The entries are a consistent snapshot of the subtree.
+    Snapshot bool
+}
+
+// Implemented by backends that can read whole subtrees natively.
+type TreeReader interface {
+    GetTree(root string, opts WalkOptions) ([]TreeEntry, error)
+}
+
+// Calls fn for root and every key under it, level by level, siblings in sorted order, stopping at
+// the first error fn returns, which is then returned. Fails with OpErrNoEntry if there is no root.
+//
+// Backends that do not implement TreeReader are read one key at a time, so keys changed meanwhile
+// may or may not be seen as changed. With opts.Snapshot, the subtree is read there until two reads
+// in a row give the same keys and versions, and only then is fn called.
+func Walk(c Client, root string, opts WalkOptions, fn func(entry TreeEntry) error) error {
+    if _, err := DisassembleKey(root); err != nil {
+        return err
+    }
+    if _, ok := c.(TreeReader); ok || opts.Snapshot {
+        entries, err := GetTree(c, root, opts)
+        if err != nil {
+            return err
+        }
+        for _, entry := range entries {
+            if err := fn(entry); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+    return walkKeys(c, root, opts, fn)
+}
+
+// Same as Walk, but returns the entries instead.
+func GetTree(c Client, root string, opts WalkOptions) ([]TreeEntry, error) {
+    if _, err := DisassembleKey(root); err != nil {
+        return nil, err
+    }
+    if tr, ok := c.(TreeReader); ok {
+        return tr.GetTree(root, opts)
+    }
+
+    var last []TreeEntry
+    for {
+        entries := []TreeEntry{}
+        err := walkKeys(c, root, opts, func(entry TreeEntry) error {
+            entries = append(entries, entry)
+            return nil
+        })
+        if err != nil {
+            return nil, err
+        }
+        if !opts.Snapshot || (last != nil && sameEntries(last, entries)) {
+            return entries, nil
+        }
+        last = entries
+    }
+}
+
+func sameEntries(a []TreeEntry, b []TreeEntry) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i].Key != b[i].Key || a[i].Ver != b[i].Ver || !bytes.Equal(a[i].Value, b[i].Value) {
+            return false
+        }
+    }
+    return true
+}
+
+func walkKeys(c Client, root string, opts WalkOptions, fn func(entry TreeEntry) error) error {
+    type item struct {
+        key string
+        depth int
+    }
+    queue := []item{{root, 0}}
+    for len(queue) != 0 {
+        it := queue[0]
+        queue = queue[1:]
+
+        entry := TreeEntry{Key: it.key}
+        var err error
+        if opts.KeysOnly {
+            entry.Ver, _, err = c.Exists(it.key, false)
+            if err == nil && entry.Ver == 0 {
+                err = OpErrNoEntry
+            }
+        } else {
+            entry.Ver, entry.Value, _, err = c.Get(it.key, false)
+        }
+        var children []string
+        if err == nil && (opts.MaxDepth == 0 || it.depth < opts.MaxDepth) {
+            children, _, err = c.Children(it.key, false)
+        }
+        if errors.Is(err, OpErrNoEntry) && it.depth != 0 {
+            // Erased while walking.
+            continue
+        }
+        if err != nil {
+            return err
+        }
+
+        if err := fn(entry); err != nil {
+            return err
+        }
+        sort.Strings(children)
+        for _, child := range children {
+            queue = append(queue, item{child, it.depth + 1})
+        }
+    }
+    return nil
+}
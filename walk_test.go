@@ -0,0 +1,94 @@
+package goffkv_test
+
+import (
+    "bytes"
+    "errors"
+    goffkv "github.com/offscale/goffkv"
+    _ "github.com/offscale/goffkv/mem"
+    "testing"
+)
+
+func testWalk(t *testing.T, client goffkv.Client) {
+    _ = client.Erase("/tree", 0)
+    defer client.Erase("/tree", 0)
+
+    _, err := goffkv.GetTree(client, "/tree", goffkv.WalkOptions{})
+    if err != goffkv.OpErrNoEntry {
+        t.Fatalf("expected goffkv.OpErrNoEntry error, found %v", err)
+    }
+
+    vers := make(map[string]goffkv.Version)
+    for _, key := range []string{"/tree", "/tree/b", "/tree/a", "/tree/a/x", "/tree/b/y", "/tree/a/x/deep"} {
+        ver, err := client.Create(key, []byte(key), false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        vers[key] = ver
+    }
+
+    expected := []string{"/tree", "/tree/a", "/tree/b", "/tree/a/x", "/tree/b/y", "/tree/a/x/deep"}
+    check := func(entries []goffkv.TreeEntry, keys []string, keysOnly bool) {
+        if len(entries) != len(keys) {
+            t.Fatalf("expected %v entries, found %+v", len(keys), entries)
+        }
+        for i, entry := range entries {
+            if entry.Key != keys[i] || entry.Ver != vers[keys[i]] {
+                t.Fatalf("expected %s at version %v, found %+v", keys[i], vers[keys[i]], entry)
+            }
+            if keysOnly && entry.Value != nil {
+                t.Fatalf("expected no value, found %v", entry.Value)
+            }
+            if !keysOnly && !bytes.Equal(entry.Value, []byte(keys[i])) {
+                t.Fatalf("expected value %v, found %v", []byte(keys[i]), entry.Value)
+            }
+        }
+    }
+
+    entries, err := goffkv.GetTree(client, "/tree", goffkv.WalkOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    check(entries, expected, false)
+
+    entries, err = goffkv.GetTree(client, "/tree", goffkv.WalkOptions{MaxDepth: 1, KeysOnly: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    check(entries, expected[:3], true)
+
+    entries, err = goffkv.GetTree(client, "/tree/a", goffkv.WalkOptions{Snapshot: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    check(entries, []string{"/tree/a", "/tree/a/x", "/tree/a/x/deep"}, false)
+
+    errStop := errors.New("stop")
+    walked := []goffkv.TreeEntry{}
+    err = goffkv.Walk(client, "/tree", goffkv.WalkOptions{}, func(entry goffkv.TreeEntry) error {
+        walked = append(walked, entry)
+        if len(walked) == 4 {
+            return errStop
+        }
+        return nil
+    })
+    if err != errStop {
+        t.Fatalf("expected the error of fn, found %v", err)
+    }
+    check(walked, expected[:4], false)
+}
+
+func TestWalk(t *testing.T) {
+    client, err := goffkv.Open("mem://walk", "/prefix")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    t.Run("native", func(t *testing.T) {
+        testWalk(t, client)
+    })
+
+    t.Run("fallback", func(t *testing.T) {
+        testWalk(t, plainClient{client})
+    })
+}